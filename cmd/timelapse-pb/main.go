@@ -4,6 +4,12 @@ import (
 	"Timelapse-PixelBattle/internal/db"
 	"Timelapse-PixelBattle/internal/graphics"
 	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -19,41 +25,310 @@ func main() {
 		log.SetType(log.LoggerDebug)
 	}
 
-	err := graphics.LoadTextureAtlas("assets", cli.TextureSize)
+	tints, err := graphics.BuildTintTable(cli.Tint)
 	if err != nil {
-		log.Fatalf("Could not load textures: %v", err)
+		log.Fatalf("Invalid tint configuration: %v", err)
+	}
+	atlasLoaded := false
+	if cli.Atlas != "" && ctx.Command() != "textures build" {
+		err = graphics.LoadAtlasCache(cli.Atlas, cli.Assets, cli.TextureSize, tints)
+		if err != nil {
+			log.Warn("Texture atlas cache is not usable, decoding textures instead. Error: " + err.Error())
+		}
+		atlasLoaded = err == nil
+	}
+	if !atlasLoaded {
+		issues, err := graphics.LoadTextureAtlas(cli.Assets, cli.TextureSize, tints)
+		for _, issue := range issues {
+			log.Warn(fmt.Sprintf("Texture %s: %s", issue.File, issue.Problem))
+		}
+		if err != nil {
+			log.Fatalf("Could not load textures: %v", err)
+		}
+		if len(issues) > 0 && cli.StrictTextures {
+			log.Fatalf("Found %d texture problems, refusing to render with --strict-textures", len(issues))
+		}
 	}
 	timer := time.Now()
 
-	//  LOAD DB
-	data := loadData(cli.PlayerName, cli.DBSource, cli.DBIp, cli.DBUser, cli.DBPassword, cli.DBName, cli.DBTable, cli.DBTLS, cli.Local)
+	if ctx.Command() == "textures build" {
+		err = graphics.WriteAtlasCache(cli.Textures.Build.Output, cli.Assets, cli.TextureSize, tints)
+		if err != nil {
+			log.Fatalf("Application failed: %v", err)
+		}
+		log.Successf("Application finished in %v", time.Since(timer))
+		return
+	}
+
+	// fail before spending minutes on the database
+	var outputs []entities.OutputTarget
+	switch ctx.Command() {
+	case "render":
+		for _, spec := range cli.Render.Output {
+			target, err := graphics.ParseOutput(spec)
+			if err != nil {
+				log.Fatalf("Invalid output: %v", err)
+			}
+			outputs = append(outputs, target)
+		}
+	case "compare":
+		outputs = []entities.OutputTarget{{File: cli.Compare.Output}}
+		if cli.Reverse || cli.Checkpoint != "" || cli.Resume {
+			log.Fatal("--reverse, --checkpoint and --resume are not supported by compare")
+		}
+		if cli.Aspect != "" {
+			log.Fatal("--aspect is not supported by compare, set the frame with --width and --height")
+		}
+	}
+	if cli.Aspect != "" && cli.Checkpoint != "" {
+		log.Fatal("--aspect cannot be combined with --checkpoint, a resumed render would frame only the records after the checkpoint")
+	}
+	if ctx.Command() == "render" || ctx.Command() == "compare" {
+		for _, target := range outputs {
+			// an explicit --codec has to fit every output, without it each container uses its own default
+			if err = graphics.ValidateOutput(target.File, cli.Codec, cli.Encoder); err != nil {
+				log.Fatalf("Invalid output: %v", err)
+			}
+		}
+		hasFFmpeg, hasFFprobe := graphics.DetectTools()
+		probeWarned := false
+		written := make(map[string]bool)
+		for i, target := range outputs {
+			if graphics.NeedsFFmpeg(target.File) && !hasFFmpeg {
+				target = ffmpegFallback(target, cli)
+				outputs[i] = target
+			}
+			if written[target.File] {
+				log.Fatalf("%s is written by more than one output", target.File)
+			}
+			written[target.File] = true
+			if graphics.NeedsFFmpeg(target.File) {
+				if !hasFFprobe && !probeWarned {
+					log.Warn("ffprobe was not found on PATH, the rendered video will not be verified")
+					probeWarned = true
+				}
+			}
+			if (cli.Audio != "" || cli.ClickTrack) && !graphics.SupportsAudio(target.File) {
+				log.Fatalf("--audio and --click-track need a video output (.mp4, .mkv, .webm, .mov), %s cannot carry sound", target.File)
+			}
+		}
+		if ctx.Command() == "compare" {
+			cli.Compare.Output = outputs[0].File
+		}
+		if cli.Intro < 0 || cli.Hold < 0 || cli.Outro < 0 || cli.Crossfade < 0 {
+			log.Fatal("--intro, --hold, --outro and --crossfade are lengths in seconds, they cannot be negative")
+		}
+		if cli.ClickVolume < 0 || cli.ClickVolume > 1 {
+			log.Fatalf("--click-volume is a level from 0 to 1, got %v", cli.ClickVolume)
+		}
+		if cli.Pace < 0 {
+			log.Fatal("--pace is the real time per frame, it cannot be negative")
+		}
+		if cli.Workers < 0 {
+			log.Fatal("--workers cannot be negative, use 0 for one per CPU core")
+		}
+		if cli.Workers == 0 {
+			cli.Workers = runtime.NumCPU()
+		}
+		if cli.Highlight < 0 || cli.FadeIn < 0 {
+			log.Fatal("--highlight and --fade-in are lengths in frames, they cannot be negative")
+		}
+		if cli.Crossfade > 0 && cli.Outro == 0 {
+			log.Warn("--crossfade blends into the stats card, it does nothing without --outro")
+		}
+		if cli.Audio != "" {
+			if _, err = os.Stat(cli.Audio); err != nil {
+				log.Fatalf("Audio file is not readable: %v", err)
+			}
+		}
+	}
+
+	if cli.DBAction != "" {
+		if err = db.ValidateColumn(cli.DBAction); err != nil {
+			log.Fatalf("Invalid --db-action-column: %v", err)
+		}
+	}
+
+	// records drawn before the checkpoint are already on its canvas
+	var startID int64
+	if cli.Resume {
+		if cli.Checkpoint == "" {
+			log.Fatal("--resume needs the --checkpoint file to resume from")
+		}
+		startID, err = graphics.CheckpointRecordID(cli.Checkpoint)
+		if err != nil {
+			log.Fatalf("Cannot resume: %v", err)
+		}
+	}
+
+	//  LOAD DB (every tile of a compare render loads its own records)
+	var data *[]entities.VisualData
+	if ctx.Command() != "compare" {
+		data = loadData(cli.PlayerName, cli.DBSource, cli.DBIp, cli.DBUser, cli.DBPassword, cli.DBName, cli.DBTable, cli.DBAction, cli.DBTLS, cli.Local, startID)
+	}
 
 	switch ctx.Command() {
 	case "render":
 
-		err = graphics.EncodeGPU(*data, cli.Width, cli.Height, cli.Iterations, cli.TextureSize, cli.Framerate, cli.Render.Output, cli.PlayerName, cli.WithInfo, cli.Debug)
+		err = graphics.EncodeGPU(*data, cli.Width, cli.Height, cli.Iterations, cli.TextureSize, cli.Framerate, outputs, cli.PlayerName, cli.WithInfo, cli.Debug, cli.FreezeAnimations, cli.Reverse, encoderOptions(cli), entities.CheckpointOptions{
+			File:   cli.Checkpoint,
+			Every:  cli.CheckpointEvery,
+			Resume: cli.Resume,
+		}, cardOptions(cli), entities.FramingOptions{Aspect: cli.Aspect, Mode: cli.Framing})
+	case "compare":
+		var tiles []entities.CompareTile
+		tiles, err = loadTiles(cli)
+		if err == nil {
+			err = graphics.EncodeCompare(tiles, cli.Width, cli.Height, cli.Iterations, cli.TextureSize, cli.Framerate, cli.Compare.Output, cli.Compare.Sync, cli.WithInfo, cli.Debug, cli.FreezeAnimations, encoderOptions(cli), cardOptions(cli))
+		}
 	case "photo":
 		err = graphics.GeneratePhotoLocal(data, cli.Width, cli.Height, cli.TextureSize, cli.Photo.Output)
 	}
 
+	// a failed render or verification has to be visible to scripts, not only in the log
 	if err != nil {
-		log.Errorf("Application failed: %v", err)
-		return
+		log.Fatalf("Application failed: %v", err)
 	}
 
 	log.Successf("Application finished in %v", time.Since(timer))
 }
 
-func loadData(playername, dbSource, dbIp, dbUser, dbPassword, dbName, dbTable string, dbTLS, local bool) *[]entities.VisualData {
+// ffmpegFallback - output written in pure Go next to one that needs the missing ffmpeg: Motion-JPEG .avi for a video,
+// .gif for an animation. Checkpoints and sound need ffmpeg, a render using them still stops
+func ffmpegFallback(target entities.OutputTarget, cli entities.CLI) entities.OutputTarget {
+	ext := ".avi"
+	if strings.EqualFold(filepath.Ext(target.File), ".apng") || strings.EqualFold(filepath.Ext(target.File), ".webp") {
+		ext = ".gif"
+	}
+	fallback := strings.TrimSuffix(target.File, filepath.Ext(target.File)) + ext
+	if cli.Checkpoint != "" || cli.Audio != "" || cli.ClickTrack {
+		log.Fatalf("ffmpeg was not found on PATH, it is required for %s. Install ffmpeg, %s can be written without it but not with --checkpoint, --audio or --click-track", target.File, fallback)
+	}
+	if target.Width > 0 {
+		log.Warn(fmt.Sprintf("ffmpeg was not found on PATH, writing %s instead of %s at the canvas size, not %dx%d", fallback, target.File, target.Width, target.Height))
+	} else {
+		log.Warn(fmt.Sprintf("ffmpeg was not found on PATH, writing %s instead of %s", fallback, target.File))
+	}
+	return entities.OutputTarget{File: fallback}
+}
+
+// encoderOptions - encoder, quality, audio and effect flags shared by render and compare
+func encoderOptions(cli entities.CLI) entities.EncoderOptions {
+	return entities.EncoderOptions{
+		Codec:       cli.Codec,
+		Encoder:     cli.Encoder,
+		GPUIndex:    cli.GPUIndex,
+		VAAPIDevice: cli.VAAPIDevice,
+		Quality:     cli.Quality,
+		CRF:         cli.CRF,
+		Bitrate:     cli.Bitrate,
+		MaxRate:     cli.MaxRate,
+		Preset:      cli.Preset,
+		Tune:        cli.Tune,
+
+		PixelPerfect: cli.PixelPerfect,
+		Lossless:     cli.Lossless,
+		Upscale:      cli.Upscale,
+		MaxSize:      cli.MaxSize,
+
+		Audio: entities.AudioOptions{
+			File:    cli.Audio,
+			Mode:    cli.AudioMode,
+			FadeIn:  cli.AudioFadeIn,
+			FadeOut: cli.AudioFadeOut,
+
+			Clicks:      cli.ClickTrack,
+			ClickVolume: cli.ClickVolume,
+		},
+		Effects: entities.EffectOptions{
+			Highlight:      cli.Highlight,
+			HighlightColor: cli.HighlightColor,
+			FadeIn:         cli.FadeIn,
+		},
+		Workers: cli.Workers,
+		Pace:    cli.Pace,
+	}
+}
+
+// cardOptions - title and stats card flags
+func cardOptions(cli entities.CLI) entities.CardOptions {
+	return entities.CardOptions{
+		Title:     cli.Title,
+		Intro:     cli.Intro,
+		Hold:      cli.Hold,
+		Outro:     cli.Outro,
+		Crossfade: cli.Crossfade,
+	}
+}
+
+// loadTiles - records of every --tile, given as LABEL:key=value,... where player, source, name and table override
+// --playername, --db-source, --db-name and --db-table. A tile without ':' is a player name used as its label
+func loadTiles(cli entities.CLI) ([]entities.CompareTile, error) {
+	if len(cli.Compare.Tiles) < 2 || len(cli.Compare.Tiles) > 4 {
+		return nil, fmt.Errorf("compare needs 2 to 4 --tile flags, got %d", len(cli.Compare.Tiles))
+	}
+	tiles := make([]entities.CompareTile, 0, len(cli.Compare.Tiles))
+	for _, spec := range cli.Compare.Tiles {
+		label, options, found := strings.Cut(spec, ":")
+		player, source, name, table := cli.PlayerName, cli.DBSource, cli.DBName, cli.DBTable
+		ip, user, password, tls := cli.DBIp, cli.DBUser, cli.DBPassword, cli.DBTLS
+		if !found {
+			player = label
+		}
+		for _, option := range strings.Split(options, ",") {
+			if strings.TrimSpace(option) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				return nil, fmt.Errorf("%q: expected key=value, got %q", spec, option)
+			}
+			switch strings.TrimSpace(key) {
+			case "player":
+				player = value
+			case "source":
+				source = value
+			case "name":
+				name = value
+			case "table":
+				table = value
+			case "ip":
+				ip = value
+			case "user":
+				user = value
+			case "password":
+				password = value
+			case "tls":
+				enabled, err := strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("%q: tls must be true or false, got %q", spec, value)
+				}
+				tls = enabled
+			default:
+				return nil, fmt.Errorf("%q: unknown key %q, use player, source, ip, user, password, tls, name or table", spec, key)
+			}
+		}
+		if label == "" {
+			return nil, fmt.Errorf("%q: the tile needs a label", spec)
+		}
+
+		log.Info(fmt.Sprintf("Loading tile %q", label))
+		data := loadData(player, source, ip, user, password, name, table, cli.DBAction, tls, cli.Local, 0)
+		tiles = append(tiles, entities.CompareTile{Label: label, Data: *data})
+	}
+	return tiles, nil
+}
+
+func loadData(playername, dbSource, dbIp, dbUser, dbPassword, dbName, dbTable, dbAction string, dbTLS, local bool, startID int64) *[]entities.VisualData {
 	log.Infof("Retrieving data from database: %s", dbName)
 	db.Init(dbSource, dbIp, dbUser, dbPassword, dbName, dbTLS, local)
 	num, _ := db.GetMaxCount(dbTable, playername)
 	data := make([]entities.VisualData, 0, num)
-	var id int64
+	id := startID
 	startTime := time.Now()
 	log.Infof("Current db record count is %d", num)
 	for {
-		sub := db.GetData(playername, dbTable, id)
+		sub := db.GetData(playername, dbTable, dbAction, id)
 		if sub == nil || len(*sub) == 0 {
 			break
 		}
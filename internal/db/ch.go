@@ -3,13 +3,12 @@ package db
 import (
 	"Timelapse-PixelBattle/pkg/entities"
 	"context"
-	"strings"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/vovamod/utils/log"
 )
 
-func retrieveFromCh(query string, args []any) *[]entities.VisualData {
+func retrieveFromCh(query string, args []any, withAction bool) *[]entities.VisualData {
 	rowsCh, err := clientCH.Query(context.Background(), query, args...)
 	if err != nil {
 		log.Error("An error occurred during data retrieval. Error: " + err.Error())
@@ -30,14 +29,22 @@ func retrieveFromCh(query string, args []any) *[]entities.VisualData {
 	var preparedData []entities.VisualData
 	for rowsCh.Next() {
 		var singleData entities.VisualData
-		if err = rowsCh.Scan(&singleData.Id, &singleData.Time, &singleData.X, &singleData.Y, &singleData.BlockTexture, &singleData.Owner); err != nil {
+		var action string
+		fields := []any{&singleData.Id, &singleData.Time, &singleData.X, &singleData.Y, &singleData.BlockTexture, &singleData.Owner}
+		if withAction {
+			fields = append(fields, &action)
+		}
+		if err = rowsCh.Scan(fields...); err != nil {
 			log.Warn("An error occurred while reading row, ignoring. Error: " + err.Error())
+			continue
 		}
-		if singleData.BlockTexture == "" || &singleData.X == nil || &singleData.Y == nil {
+		if &singleData.X == nil || &singleData.Y == nil {
 			continue
 		}
 
-		singleData.BlockTexture = strings.ToLower(singleData.BlockTexture) + ".png"
+		if !prepareRecord(&singleData, action) {
+			continue
+		}
 		preparedData = append(preparedData, singleData)
 	}
 
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strings"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
@@ -26,6 +27,13 @@ const (
 	TableCount  = `SELECT COUNT(*) FROM `
 )
 
+var (
+	// removalBlocks - block names of an emptied cell (names are lower case here)
+	removalBlocks = map[string]bool{"air": true, "cave_air": true, "void_air": true}
+	// removalActions - values of the action column for a broken block
+	removalActions = map[string]bool{"break": true, "broken": true, "remove": true, "removed": true, "destroy": true, "erase": true}
+)
+
 func ClickHouseConn(databaseIp, databaseUser, databasePassword, databaseName string, databaseTLSEnabled bool) (driver.Conn, error) {
 	var (
 		dialCount = 0
@@ -107,14 +115,30 @@ func Close() {
 	}
 }
 
-func GetData(playername string, table string, id int64) *[]entities.VisualData {
-	query, args := buildQuery(playername, table, id)
+// ValidateColumn - column names are spliced into the query (placeholders only take values), only plain identifiers
+// are accepted
+func ValidateColumn(name string) error {
+	for i, r := range name {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9') {
+			continue
+		}
+		return fmt.Errorf("%q is not a column name, use letters, digits and underscores", name)
+	}
+	if name == "" {
+		return errors.New("column name is empty")
+	}
+	return nil
+}
+
+// GetData - next page of records after id. actionColumn (optional) names the column telling placements and breaks apart
+func GetData(playername, table, actionColumn string, id int64) *[]entities.VisualData {
+	query, args := buildQuery(playername, table, actionColumn, id)
 
 	// Split logic for easier reading
 	if local {
-		return retrieveFromSqlite(query, args)
+		return retrieveFromSqlite(query, args, actionColumn != "")
 	}
-	return retrieveFromCh(query, args)
+	return retrieveFromCh(query, args, actionColumn != "")
 }
 
 func GetMaxCount(table string, playername string) (int, error) {
@@ -139,8 +163,27 @@ func GetMaxCount(table string, playername string) (int, error) {
 	return int(totalRecords), nil
 }
 
-func buildQuery(playername string, table string, id int64) (string, []any) {
+// prepareRecord - texture file name of the block, air blocks and break actions become removals. Rows without a block
+// are skipped (false) as they always were, unless the action column marks them as a break
+func prepareRecord(data *entities.VisualData, action string) bool {
+	block := strings.ToLower(data.BlockTexture)
+	data.Removed = removalBlocks[block] || removalActions[strings.ToLower(action)]
+	if block == "" && !data.Removed {
+		return false
+	}
+	if block == "" || removalBlocks[block] {
+		data.BlockTexture = ""
+		return true
+	}
+	data.BlockTexture = block + ".png"
+	return true
+}
+
+func buildQuery(playername, table, actionColumn string, id int64) (string, []any) {
 	base := TableSelect + table
+	if actionColumn != "" {
+		base = strings.Replace(TableSelect, " FROM ", ", "+actionColumn+" FROM ", 1) + table
+	}
 
 	switch {
 	case playername != "" && id != 0:
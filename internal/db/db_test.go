@@ -0,0 +1,33 @@
+package db
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"testing"
+)
+
+func TestPrepareRecord(t *testing.T) {
+	tests := []struct {
+		block, action string
+		keep          bool
+		removed       bool
+		texture       string
+	}{
+		{block: "Stone", keep: true, texture: "stone.png"},
+		{block: "", keep: false},
+		{block: "", action: "break", keep: true, removed: true},
+		{block: "AIR", keep: true, removed: true},
+		{block: "cave_air", action: "place", keep: true, removed: true},
+		{block: "dirt", action: "Destroy", keep: true, removed: true, texture: "dirt.png"},
+	}
+	for _, tt := range tests {
+		data := entities.VisualData{BlockTexture: tt.block}
+		keep := prepareRecord(&data, tt.action)
+		if keep != tt.keep {
+			t.Errorf("%q/%q: kept %v, want %v", tt.block, tt.action, keep, tt.keep)
+			continue
+		}
+		if keep && (data.Removed != tt.removed || data.BlockTexture != tt.texture) {
+			t.Errorf("%q/%q: removed %v texture %q, want %v %q", tt.block, tt.action, data.Removed, data.BlockTexture, tt.removed, tt.texture)
+		}
+	}
+}
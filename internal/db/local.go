@@ -3,12 +3,11 @@ package db
 import (
 	"Timelapse-PixelBattle/pkg/entities"
 	"database/sql"
-	"strings"
 
 	"github.com/vovamod/utils/log"
 )
 
-func retrieveFromSqlite(query string, args []any) *[]entities.VisualData {
+func retrieveFromSqlite(query string, args []any, withAction bool) *[]entities.VisualData {
 	rowsL, err := clientLocal.Query(query, args...)
 	if err != nil {
 		log.Error("An error occurred during data retrieval. Error: " + err.Error())
@@ -29,14 +28,22 @@ func retrieveFromSqlite(query string, args []any) *[]entities.VisualData {
 	var preparedData []entities.VisualData
 	for rowsL.Next() {
 		var singleData entities.VisualData
-		if err = rowsL.Scan(&singleData.Id, &singleData.Time, &singleData.X, &singleData.Y, &singleData.BlockTexture, &singleData.Owner); err != nil {
+		var action sql.NullString
+		fields := []any{&singleData.Id, &singleData.Time, &singleData.X, &singleData.Y, &singleData.BlockTexture, &singleData.Owner}
+		if withAction {
+			fields = append(fields, &action)
+		}
+		if err = rowsL.Scan(fields...); err != nil {
 			log.Warn("An error occurred while reading row, ignoring. Error: " + err.Error())
+			continue
 		}
-		if singleData.BlockTexture == "" || &singleData.X == nil || &singleData.Y == nil {
+		if &singleData.X == nil || &singleData.Y == nil {
 			continue
 		}
 
-		singleData.BlockTexture = strings.ToLower(singleData.BlockTexture) + ".png"
+		if !prepareRecord(&singleData, action.String) {
+			continue
+		}
 		preparedData = append(preparedData, singleData)
 	}
 
@@ -0,0 +1,320 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"github.com/vovamod/utils/log"
+)
+
+// animationFormats - looping animation outputs, picked by file extension instead of --codec
+var animationFormats = map[string]string{
+	".gif":  "gif",
+	".apng": "apng",
+	".webp": "webp",
+}
+
+// maxSizeAttempts - renders tried before giving up on --max-size
+const maxSizeAttempts = 4
+
+// encodeAnimation - renders a looping animation. With a size limit the output is rendered again keeping every n-th
+// frame (playback length stays the same) until the file fits
+func encodeAnimation(dest []entities.VisualData, render frameRender, start *renderState, filename, format string, quality qualitySettings, maxSize string, debug bool) error {
+	limit, err := parseSize(maxSize)
+	if err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("Rendering %s animation, output resolution: %dx%d", format, render.width*max(quality.Upscale, 1), render.frameHeight()*max(quality.Upscale, 1)))
+
+	step := 1
+	for attempt := 1; ; attempt++ {
+		var sink frameSink
+		if format == "gif" {
+			sink, err = newGIFSink(filename, dest, render, step, quality.Upscale)
+			if err != nil {
+				return err
+			}
+		} else {
+			sink = newFFmpegSink(filename, render.width, render.frameHeight(), render.framerate, step, animationArgs(format, quality), nil, debug)
+		}
+
+		frames, err := render.run(dest, step, start.clone(), sink)
+		if err != nil {
+			return err
+		}
+		if err = sink.Close(); err != nil {
+			return err
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("could not stat output: %w", err)
+		}
+		if limit == 0 || info.Size() <= limit {
+			log.Successf("Animation saved to: %s (%d frames, %d bytes)", filename, frames, info.Size())
+			return nil
+		}
+		if attempt == maxSizeAttempts || frames <= 1 {
+			return fmt.Errorf("%s is %d bytes with %d frames, still over --max-size of %d bytes. Lower --width/--height or --quality", filename, info.Size(), frames, limit)
+		}
+
+		// frames dominate the size, drop proportionally and keep a margin for the frames that get harder to compress
+		next := int(math.Ceil(float64(step) * float64(info.Size()) / float64(limit) * 1.1))
+		step = max(next, step+1)
+		log.Warn(fmt.Sprintf("%s is %d bytes, over the %d bytes limit. Rendering again with every %d frame", filename, info.Size(), limit, step))
+	}
+}
+
+// animationArgs - ffmpeg output arguments of the animated formats ffmpeg writes for us
+func animationArgs(format string, quality qualitySettings) ffmpeg.KwArgs {
+	args := ffmpeg.KwArgs{}
+	if quality.Upscale > 1 {
+		args["vf"] = fmt.Sprintf("scale=iw*%d:ih*%d:flags=neighbor", quality.Upscale, quality.Upscale)
+	}
+	speed := presetIndex(quality.Preset)
+
+	switch format {
+	case "apng":
+		args["c:v"] = "apng"
+		args["f"] = "apng"
+		args["pix_fmt"] = "rgb24"
+		args["pred"] = "mixed"
+		args["plays"] = "0"
+	case "webp":
+		args["c:v"] = "libwebp_anim"
+		args["loop"] = "0"
+		args["compression_level"] = strconv.Itoa(speed * 6 / 8)
+		if quality.PixelPerfect {
+			args["lossless"] = "1"
+			args["pix_fmt"] = "bgra"
+		} else {
+			// webp quality is 0-100, higher is better
+			args["quality"] = strconv.Itoa(100 - quality.CRF*100/51)
+			args["pix_fmt"] = "yuv420p"
+		}
+	}
+	return args
+}
+
+// parseSize - "8M", "500k", "25MB" or plain bytes. Binary units, empty is no limit
+func parseSize(size string) (int64, error) {
+	if size == "" {
+		return 0, nil
+	}
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(size), "B"), "I")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	value, err := strconv.ParseFloat(strings.TrimRight(number, "KMG"), 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 8M or 500k", size)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// gifSink - pure Go GIF writer. image/gif only encodes whole animations, so every frame is encoded as a single image
+// GIF and its image block is appended to the file, each frame is a full frame so any of them can be dropped.
+// A frame is held back until the next one arrives, skipped frames only lengthen its delay
+type gifSink struct {
+	f       *os.File
+	w       *bufio.Writer
+	frame   *image.Paletted
+	lookup  map[uint32]uint8
+	width   int
+	upscale int
+	delay   gifDelay
+	buf     bytes.Buffer
+	started bool
+
+	pending      []byte // image block of the last frame, not written yet
+	pendingDelay int
+}
+
+// gifDelay - GIF delays are in 1/100 s, the rounding error is carried over so the total length stays exact
+type gifDelay struct {
+	framerate, step, frame int
+}
+
+func (d *gifDelay) next() int {
+	at := func(frame int) int { return frame * d.step * 100 / d.framerate }
+	delay := at(d.frame+1) - at(d.frame)
+	d.frame++
+	return delay
+}
+
+func newGIFSink(filename string, dest []entities.VisualData, render frameRender, step, upscale int) (*gifSink, error) {
+	upscale = max(upscale, 1)
+	w, h := render.width*upscale, render.frameHeight()*upscale
+	if w >= 1<<16 || h >= 1<<16 {
+		return nil, fmt.Errorf("%dx%d is too large for a GIF", w, h)
+	}
+	if step*100/render.framerate < 2 {
+		log.Warn(fmt.Sprintf("GIF frames are at least 1/50 s, most players slow %d fps down. Use a lower --framerate", render.framerate/step))
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not create file: %w", err)
+	}
+	return &gifSink{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		frame:   image.NewPaletted(image.Rect(0, 0, w, h), gifPalette(dest)),
+		lookup:  make(map[uint32]uint8),
+		width:   render.width,
+		upscale: upscale,
+		delay:   gifDelay{framerate: render.framerate, step: step},
+	}, nil
+}
+
+func (s *gifSink) WriteFrame(pix []uint8) error {
+	// RGB24 -> palette index, pixel art has few distinct colours so the nearest search is cached
+	dst := s.frame.Pix
+	rowWidth := s.width * s.upscale
+	for y := 0; y < len(pix)/(s.width*3); y++ {
+		row := dst[y*s.upscale*rowWidth : (y*s.upscale+1)*rowWidth]
+		src := pix[y*s.width*3:]
+		for x := 0; x < s.width; x++ {
+			key := uint32(src[x*3])<<16 | uint32(src[x*3+1])<<8 | uint32(src[x*3+2])
+			idx, ok := s.lookup[key]
+			if !ok {
+				idx = uint8(s.frame.Palette.Index(color.RGBA{R: src[x*3], G: src[x*3+1], B: src[x*3+2], A: 255}))
+				s.lookup[key] = idx
+			}
+			for sx := 0; sx < s.upscale; sx++ {
+				row[x*s.upscale+sx] = idx
+			}
+		}
+		for sy := 1; sy < s.upscale; sy++ {
+			copy(dst[(y*s.upscale+sy)*rowWidth:], row)
+		}
+	}
+
+	s.buf.Reset()
+	if err := gif.Encode(&s.buf, s.frame, &gif.Options{NumColors: len(s.frame.Palette)}); err != nil {
+		return fmt.Errorf("gif encoding failed: %w", err)
+	}
+	single := s.buf.Bytes()
+
+	// single image layout: header(6) | screen descriptor(7) | global colour table | image block | trailer(1)
+	headerLen := 13
+	if single[10]&0x80 != 0 {
+		headerLen += 3 << (single[10]&7 + 1)
+	}
+	if !s.started {
+		s.w.Write(single[:headerLen])
+		// NETSCAPE2.0 application extension, loop forever
+		s.w.Write([]byte{0x21, 0xFF, 0x0B, 'N', 'E', 'T', 'S', 'C', 'A', 'P', 'E', '2', '.', '0', 0x03, 0x01, 0x00, 0x00, 0x00})
+		s.started = true
+	}
+	if err := s.flushPending(); err != nil {
+		return err
+	}
+	s.pending = append(s.pending[:0], single[headerLen:len(single)-1]...)
+	s.pendingDelay = s.delay.next()
+	return nil
+}
+
+// SkipFrame - the held back frame stays on screen a frame longer (GIF delays top out at 655 s, then it is repeated)
+func (s *gifSink) SkipFrame() error {
+	delay := s.delay.next()
+	if s.pendingDelay+delay > 0xFFFF {
+		if err := s.flushPending(); err != nil {
+			return err
+		}
+		s.pendingDelay = 0
+	}
+	s.pendingDelay += delay
+	return nil
+}
+
+// flushPending - graphic control extension with the delay, then the image block
+func (s *gifSink) flushPending() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	delay := s.pendingDelay
+	s.w.Write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+	if _, err := s.w.Write(s.pending); err != nil {
+		return fmt.Errorf("could not write gif frame: %w", err)
+	}
+	return nil
+}
+
+func (s *gifSink) Close() error {
+	defer func(f *os.File) {
+		err := f.Close()
+		if err != nil {
+			log.Errorf("Error while closing file: %v", err)
+		}
+	}(s.f)
+	if !s.started {
+		return errors.New("no frames were rendered into the gif")
+	}
+	if err := s.flushPending(); err != nil {
+		return err
+	}
+	s.w.WriteByte(0x3B)
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("could not write gif: %w", err)
+	}
+	return nil
+}
+
+// gifPalette - background and footer colours plus the average colours of the textures in use, most placed first
+func gifPalette(dest []entities.VisualData) color.Palette {
+	palette := color.Palette{
+		color.RGBA{R: 255, G: 255, B: 255, A: 255}, // background and footer text
+		color.RGBA{R: 35, G: 35, B: 35, A: 255},    // footer
+	}
+
+	usage := make(map[string]int)
+	for _, block := range dest {
+		usage[block.BlockTexture]++
+	}
+	names := make([]string, 0, len(usage))
+	for name := range usage {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if usage[names[i]] != usage[names[j]] {
+			return usage[names[i]] > usage[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	seen := make(map[color.RGBA]bool)
+	for _, c := range palette {
+		seen[c.(color.RGBA)] = true
+	}
+	for _, name := range names {
+		tex, ok := getRawTexture(name)
+		if !ok || tex.Avg.A == 0 || seen[tex.Avg] {
+			continue
+		}
+		seen[tex.Avg] = true
+		palette = append(palette, tex.Avg)
+		if len(palette) == 256 {
+			break
+		}
+	}
+	return palette
+}
@@ -0,0 +1,95 @@
+package graphics
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGIFSink(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	textureCacheRaw["red.png"].Avg = color.RGBA{R: 255, A: 255}
+	const width, height, framerate = 4, 2, 10
+	render := frameRender{width: width, height: height, framerate: framerate}
+	filename := filepath.Join(t.TempDir(), "out.gif")
+
+	s, err := newGIFSink(filename, testRecords(2, "red.png"), render, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := bytes.Repeat([]byte{255, 255, 255}, width*height)
+	red := bytes.Repeat([]byte{255, 0, 0}, width*height)
+	for _, frame := range [][]byte{white, nil, nil, red, white} { // nil - skipped frame
+		if frame == nil {
+			err = s.SkipFrame()
+		} else {
+			err = s.WriteFrame(frame)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatalf("image/gif cannot read the file: %v", err)
+	}
+	if g.LoopCount != 0 {
+		t.Errorf("LoopCount %d, want 0 (NETSCAPE2.0 loop forever)", g.LoopCount)
+	}
+	if len(g.Image) != 3 {
+		t.Fatalf("%d frames, want 3 (skipped frames are not written)", len(g.Image))
+	}
+	// 10 fps is 10/100 s a frame, the skipped frames lengthen the one before them
+	if want := []int{30, 10, 10}; len(g.Delay) != 3 || g.Delay[0] != want[0] || g.Delay[1] != want[1] || g.Delay[2] != want[2] {
+		t.Errorf("delays %v, want %v", g.Delay, want)
+	}
+	if g.Config.Width != width*2 || g.Config.Height != height*2 {
+		t.Errorf("%dx%d, want the upscaled %dx%d", g.Config.Width, g.Config.Height, width*2, height*2)
+	}
+	for i, want := range []color.RGBA{{255, 255, 255, 255}, {255, 0, 0, 255}, {255, 255, 255, 255}} {
+		img := g.Image[i]
+		for _, p := range [][2]int{{0, 0}, {width*2 - 1, height*2 - 1}} {
+			if got := color.RGBAModel.Convert(img.At(p[0], p[1])).(color.RGBA); got != want {
+				t.Errorf("frame %d pixel %v = %v, want %v", i, p, got, want)
+			}
+		}
+	}
+}
+
+func TestGIFSinkEmpty(t *testing.T) {
+	s, err := newGIFSink(filepath.Join(t.TempDir(), "out.gif"), nil, frameRender{width: 2, height: 2, framerate: 10}, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Close(); err == nil {
+		t.Error("a gif without frames was accepted")
+	}
+}
+
+func TestGIFDelay(t *testing.T) {
+	// 30 fps does not divide 100, the rounding is carried so 30 frames last exactly a second
+	d := gifDelay{framerate: 30, step: 1}
+	total := 0
+	for i := 0; i < 30; i++ {
+		delay := d.next()
+		if delay < 3 || delay > 4 {
+			t.Errorf("frame %d delay %d", i, delay)
+		}
+		total += delay
+	}
+	if total != 100 {
+		t.Errorf("30 frames last %d/100 s, want 100", total)
+	}
+}
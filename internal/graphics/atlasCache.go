@@ -0,0 +1,335 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"image"
+	"image/color"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/vovamod/utils/log"
+)
+
+// Atlas cache layout (little endian):
+//
+//	header: magic[8] | version u32 | textureSize u32 | packStamp [32]byte | packHash [32]byte | count u32 | indexSize u32
+//	index:  per texture - nameLen u16 | name | w u16 | h u16 | avg [4]byte | frames u16 | seqLen u16 | seq (index u16, time u32)... | dataOffset u64
+//	data:   per frame RGBA pixels (w*h*4) followed by RGB24 pixels (w*h*3), max(frames, 1) frames per texture.
+//	        dataOffset is relative to the start of this section
+const (
+	atlasMagic      = "TPBATLAS"
+	atlasVersion    = 3
+	atlasHeaderSize = 8 + 4 + 4 + 2*sha256.Size + 4 + 4
+)
+
+// WriteAtlasCache - serializes the currently loaded texture atlas, keyed by texture size and the content hash of the
+// source pack. The stamp of the pack is stored next to it, a matching stamp spares loading from reading every file
+func WriteAtlasCache(filename string, assetPaths []string, textureSize int, tints map[string]color.RGBA) error {
+	stamp, err := packStamp(assetPaths, tints)
+	if err != nil {
+		return fmt.Errorf("could not stat texture pack: %w", err)
+	}
+	hash, err := packHash(assetPaths, tints)
+	if err != nil {
+		return fmt.Errorf("could not hash texture pack: %w", err)
+	}
+
+	names := make([]string, 0, len(textureCacheRaw))
+	for name := range textureCacheRaw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var index, data bytes.Buffer
+	for _, name := range names {
+		tex, _ := getRawTexture(name)
+		frames := []*entities.Texture{tex}
+		var sequence []entities.AnimationFrame
+		if tex.Animation != nil {
+			frames = tex.Animation.Frames
+			sequence = tex.Animation.Sequence
+		}
+
+		w, h := tex.Rect.Dx(), tex.Rect.Dy()
+		index.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(name))))
+		index.WriteString(name)
+		index.Write(binary.LittleEndian.AppendUint16(nil, uint16(w)))
+		index.Write(binary.LittleEndian.AppendUint16(nil, uint16(h)))
+		index.Write([]byte{tex.Avg.R, tex.Avg.G, tex.Avg.B, tex.Avg.A})
+		if tex.Animation != nil {
+			index.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(frames))))
+		} else {
+			index.Write(binary.LittleEndian.AppendUint16(nil, 0))
+		}
+		index.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(sequence))))
+		for _, f := range sequence {
+			index.Write(binary.LittleEndian.AppendUint16(nil, uint16(f.Index)))
+			index.Write(binary.LittleEndian.AppendUint32(nil, uint32(f.Time)))
+		}
+		index.Write(binary.LittleEndian.AppendUint64(nil, uint64(data.Len())))
+
+		for _, frame := range frames {
+			// rows are stored tightly packed, regardless of the source stride
+			for row := 0; row < h; row++ {
+				data.Write(frame.Pix[row*frame.Stride : row*frame.Stride+w*4])
+			}
+			data.Write(frame.RGB)
+		}
+	}
+
+	header := make([]byte, 0, atlasHeaderSize)
+	header = append(header, atlasMagic...)
+	header = binary.LittleEndian.AppendUint32(header, atlasVersion)
+	header = binary.LittleEndian.AppendUint32(header, uint32(textureSize))
+	header = append(header, stamp[:]...)
+	header = append(header, hash[:]...)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(names)))
+	header = binary.LittleEndian.AppendUint32(header, uint32(index.Len()))
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("could not create atlas file: %w", err)
+	}
+	defer func(f *os.File) {
+		err = f.Close()
+		if err != nil {
+			log.Errorf("Error while closing file: %v", err)
+		}
+	}(f)
+
+	for _, part := range [][]byte{header, index.Bytes(), data.Bytes()} {
+		if _, err = f.Write(part); err != nil {
+			return fmt.Errorf("could not write atlas file: %w", err)
+		}
+	}
+
+	log.Successf("Texture atlas with %d textures saved to: %s", len(names), filename)
+	return nil
+}
+
+// LoadAtlasCache - maps a prebuilt atlas into memory instead of decoding every png. Any mismatch is returned as an error
+// so the caller can fall back to LoadTextureAtlas
+func LoadAtlasCache(filename string, assetPaths []string, textureSize int, tints map[string]color.RGBA) error {
+	raw, err := mapFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if len(raw) < atlasHeaderSize || string(raw[:8]) != atlasMagic {
+		return errors.New("not a texture atlas file")
+	}
+	if v := binary.LittleEndian.Uint32(raw[8:]); v != atlasVersion {
+		return fmt.Errorf("atlas version %d is not supported (expected %d)", v, atlasVersion)
+	}
+	if size := int(binary.LittleEndian.Uint32(raw[12:])); size != textureSize {
+		return fmt.Errorf("atlas was built for texture size %d, requested %d", size, textureSize)
+	}
+
+	// names, sizes and mtimes first, reading the whole pack is what the atlas saves. A pack checked out or copied
+	// elsewhere has other mtimes, its content decides
+	stamp, err := packStamp(assetPaths, tints)
+	switch {
+	case os.IsNotExist(err):
+		log.Warn(fmt.Sprintf("Assets folders %v not found, using texture atlas without staleness check", assetPaths))
+	case err != nil:
+		return fmt.Errorf("could not stat texture pack: %w", err)
+	case !bytes.Equal(stamp[:], raw[16:16+sha256.Size]):
+		hash, err := packHash(assetPaths, tints)
+		if err != nil {
+			return fmt.Errorf("could not hash texture pack: %w", err)
+		}
+		if !bytes.Equal(hash[:], raw[16+sha256.Size:16+2*sha256.Size]) {
+			return errors.New("atlas is outdated, texture pack or tints changed since it was built")
+		}
+		log.Debugf("Texture pack files were touched since the atlas was built, their content is the same")
+	}
+
+	count := int(binary.LittleEndian.Uint32(raw[16+2*sha256.Size:]))
+	indexSize := int(binary.LittleEndian.Uint32(raw[20+2*sha256.Size:]))
+	if atlasHeaderSize+indexSize > len(raw) {
+		return errors.New("atlas index is truncated")
+	}
+	index := raw[atlasHeaderSize : atlasHeaderSize+indexSize]
+	data := raw[atlasHeaderSize+indexSize:]
+
+	r := atlasReader{buf: index}
+	textures := make(map[string]*entities.Texture, count)
+	for i := 0; i < count; i++ {
+		name := string(r.bytes(int(r.u16())))
+		w, h := int(r.u16()), int(r.u16())
+		avg := r.bytes(4)
+		frameCount := int(r.u16())
+		sequence := make([]entities.AnimationFrame, r.u16())
+		for j := range sequence {
+			sequence[j].Index = int(r.u16())
+			sequence[j].Time = int(r.u32())
+		}
+		offset := int(r.u64())
+		if r.err != nil {
+			return r.err
+		}
+
+		rgbaSize, rgbSize := w*h*4, w*h*3
+		frameSize := rgbaSize + rgbSize
+		frames := make([]*entities.Texture, max(frameCount, 1))
+		if offset+len(frames)*frameSize > len(data) {
+			return fmt.Errorf("atlas data of %s is truncated", name)
+		}
+		for j := range frames {
+			start := offset + j*frameSize
+			frames[j] = &entities.Texture{
+				Pix:    data[start : start+rgbaSize : start+rgbaSize],
+				RGB:    data[start+rgbaSize : start+frameSize : start+frameSize],
+				Stride: w * 4,
+				Rect:   image.Rect(0, 0, w, h),
+			}
+		}
+
+		tex := frames[0]
+		if frameCount > 0 {
+			anim := &entities.TextureAnimation{Frames: frames, Sequence: sequence}
+			for _, f := range sequence {
+				if f.Index >= len(frames) {
+					return fmt.Errorf("atlas animation of %s is corrupted", name)
+				}
+				anim.TotalTime += f.Time
+			}
+			first := frames[0]
+			if len(sequence) > 0 {
+				first = frames[sequence[0].Index]
+			}
+			tex = &entities.Texture{Pix: first.Pix, RGB: first.RGB, Stride: first.Stride, Rect: first.Rect, Animation: anim}
+		}
+		tex.Avg = color.RGBA{R: avg[0], G: avg[1], B: avg[2], A: avg[3]}
+		textures[name] = tex
+	}
+
+	for name, tex := range textures {
+		textureCacheRaw[name] = tex
+	}
+	log.Successf("Texture Atlas mapped from %s (%d textures, size: %dpx)", filename, count, textureSize)
+	return nil
+}
+
+// packStamp - sha256 over name, size and mtime of every png/mcmeta of the packs (in precedence order) plus the tint
+// table. Cheap enough for every start, a pack with another stamp is checked by its content hash.
+// Returns os.ErrNotExist if none of the packs exist
+func packStamp(assetPaths []string, tints map[string]color.RGBA) ([sha256.Size]byte, error) {
+	return hashPack(assetPaths, tints, func(hasher hash.Hash, path string, file os.DirEntry) error {
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		hasher.Write(binary.LittleEndian.AppendUint64(nil, uint64(info.Size())))
+		hasher.Write(binary.LittleEndian.AppendUint64(nil, uint64(info.ModTime().UnixNano())))
+		return nil
+	})
+}
+
+// packHash - sha256 over the content of every png/mcmeta of the packs plus the tint table, both are baked into the atlas.
+// Reads the whole pack, done by textures build and when the stamp differs. Returns os.ErrNotExist if none of the packs exist
+func packHash(assetPaths []string, tints map[string]color.RGBA) ([sha256.Size]byte, error) {
+	return hashPack(assetPaths, tints, func(hasher hash.Hash, path string, file os.DirEntry) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hasher.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(content))))
+		hasher.Write(content)
+		return nil
+	})
+}
+
+// hashPack - walks the texture files of the packs in precedence order, addFile hashes what identifies one of them
+func hashPack(assetPaths []string, tints map[string]color.RGBA, addFile func(hasher hash.Hash, path string, file os.DirEntry) error) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	hasher := sha256.New()
+	found := false
+
+	for i, assetPath := range assetPaths {
+		files, err := os.ReadDir(assetPath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return sum, err
+		}
+		found = true
+		// pack position matters for precedence, its location on disk does not
+		hasher.Write(binary.LittleEndian.AppendUint32(nil, uint32(i)))
+
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), ".png") && !strings.HasSuffix(file.Name(), ".png.mcmeta") {
+				continue
+			}
+			hasher.Write([]byte(file.Name()))
+			if err = addFile(hasher, assetPath+"/"+file.Name(), file); err != nil {
+				return sum, err
+			}
+		}
+	}
+	if !found {
+		return sum, os.ErrNotExist
+	}
+
+	names := make([]string, 0, len(tints))
+	for name := range tints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := tints[name]
+		hasher.Write([]byte(name))
+		hasher.Write([]byte{t.R, t.G, t.B, t.A})
+	}
+
+	copy(sum[:], hasher.Sum(nil))
+	return sum, nil
+}
+
+// averageColor - mean colour of the opaque pixels, transparent textures average to transparent black
+func averageColor(tex *entities.Texture) color.RGBA {
+	var r, g, b, n uint64
+	for y := 0; y < tex.Rect.Dy(); y++ {
+		row := tex.Pix[y*tex.Stride : y*tex.Stride+tex.Rect.Dx()*4]
+		for x := 0; x < len(row); x += 4 {
+			if row[x+3] == 0 {
+				continue
+			}
+			r += uint64(row[x])
+			g += uint64(row[x+1])
+			b += uint64(row[x+2])
+			n++
+		}
+	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}
+}
+
+type atlasReader struct {
+	buf []byte
+	err error
+}
+
+func (r *atlasReader) bytes(n int) []byte {
+	if r.err != nil || n > len(r.buf) {
+		r.err = errors.New("atlas index is truncated")
+		return make([]byte, n)
+	}
+	out := r.buf[:n]
+	r.buf = r.buf[n:]
+	return out
+}
+
+func (r *atlasReader) u16() uint16 { return binary.LittleEndian.Uint16(r.bytes(2)) }
+func (r *atlasReader) u32() uint32 { return binary.LittleEndian.Uint32(r.bytes(4)) }
+func (r *atlasReader) u64() uint64 { return binary.LittleEndian.Uint64(r.bytes(8)) }
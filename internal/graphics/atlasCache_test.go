@@ -0,0 +1,72 @@
+package graphics
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePack - texture pack folder with the given files
+func writePack(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestAtlasCacheRoundTrip(t *testing.T) {
+	files := map[string]string{"red.png": "red pixels", "red.png.mcmeta": "{}"}
+	pack := writePack(t, files)
+	solidTexture(t, "red.png", 255, 0, 0)
+	want := bytes.Clone(textureCacheRaw["red.png"].RGB)
+	atlas := filepath.Join(t.TempDir(), "atlas.bin")
+	if err := WriteAtlasCache(atlas, []string{pack}, 16, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(t *testing.T, pack string) error {
+		t.Helper()
+		delete(textureCacheRaw, "red.png")
+		return LoadAtlasCache(atlas, []string{pack}, 16, nil)
+	}
+
+	t.Run("same pack", func(t *testing.T) {
+		if err := load(t, pack); err != nil {
+			t.Fatal(err)
+		}
+		tex, ok := getRawTexture("red.png")
+		if !ok || !bytes.Equal(tex.RGB, want) || tex.Rect.Dx() != 16 {
+			t.Fatal("texture read back from the atlas differs")
+		}
+	})
+	t.Run("copied pack", func(t *testing.T) {
+		// another checkout: same content, other mtimes and location
+		copied := writePack(t, files)
+		later := time.Now().Add(time.Hour)
+		for name := range files {
+			if err := os.Chtimes(filepath.Join(copied, name), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := load(t, copied); err != nil {
+			t.Fatalf("atlas rejected for a copy of the pack: %v", err)
+		}
+	})
+	t.Run("stale pack", func(t *testing.T) {
+		changed := writePack(t, map[string]string{"red.png": "other pixels", "red.png.mcmeta": "{}"})
+		if err := load(t, changed); err == nil {
+			t.Fatal("atlas accepted for a changed pack")
+		}
+	})
+	t.Run("texture size", func(t *testing.T) {
+		if err := LoadAtlasCache(atlas, []string{pack}, 32, nil); err == nil {
+			t.Fatal("atlas accepted for another texture size")
+		}
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package graphics
+
+import "os"
+
+// mapFile - no mmap here, read the whole atlas instead
+func mapFile(filename string) ([]byte, error) {
+	return os.ReadFile(filename)
+}
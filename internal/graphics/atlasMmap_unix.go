@@ -0,0 +1,29 @@
+//go:build unix
+
+package graphics
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapFile - read-only mapping, the atlas stays mapped for the lifetime of the process. Textures pointing into it are
+// never written, anything changing pixels works on its own copy
+func mapFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return nil, fmt.Errorf("%s is empty", filename)
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+}
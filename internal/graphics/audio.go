@@ -0,0 +1,73 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// soundtrack - audio muxed next to the rendered frames, cut and faded to the video length
+type soundtrack struct {
+	entities.AudioOptions
+	clicks   string  // generated click track (wav), empty - none
+	duration float64 // video length in seconds
+}
+
+// newSoundtrack - nil without an audio file or click track, so the video stays silent
+func newSoundtrack(opts entities.AudioOptions, clicks string, frames, framerate int) *soundtrack {
+	if opts.File == "" && clicks == "" {
+		return nil
+	}
+	return &soundtrack{AudioOptions: opts, clicks: clicks, duration: float64(frames) / float64(framerate)}
+}
+
+// stream - audio input of the ffmpeg graph: music looped if asked and mixed with the clicks, trimmed to the video,
+// faded at both ends
+func (s *soundtrack) stream() *ffmpeg.Stream {
+	var audio *ffmpeg.Stream
+	if s.File != "" {
+		inputArgs := ffmpeg.KwArgs{}
+		if s.Mode == "loop" {
+			inputArgs["stream_loop"] = "-1"
+		}
+		audio = ffmpeg.Input(s.File, inputArgs).Audio()
+	}
+	if s.clicks != "" {
+		clicks := ffmpeg.Input(s.clicks).Audio()
+		if audio == nil {
+			audio = clicks
+		} else {
+			// normalize=0 keeps the music at its level instead of halving both inputs
+			audio = ffmpeg.Filter([]*ffmpeg.Stream{audio, clicks}, "amix", ffmpeg.Args{}, ffmpeg.KwArgs{"inputs": "2", "duration": "longest", "normalize": "0"})
+		}
+	}
+	audio = audio.
+		Filter("atrim", ffmpeg.Args{}, ffmpeg.KwArgs{"duration": seconds(s.duration)}).
+		Filter("asetpts", ffmpeg.Args{"PTS-STARTPTS"})
+	if s.FadeIn > 0 {
+		audio = audio.Filter("afade", ffmpeg.Args{}, ffmpeg.KwArgs{"t": "in", "st": "0", "d": seconds(s.FadeIn)})
+	}
+	if s.FadeOut > 0 {
+		start := max(s.duration-s.FadeOut, 0)
+		audio = audio.Filter("afade", ffmpeg.Args{}, ffmpeg.KwArgs{"t": "out", "st": seconds(start), "d": seconds(s.FadeOut)})
+	}
+	return audio
+}
+
+// codecArgs - audio encoder the container accepts, webm only takes opus/vorbis
+func (s *soundtrack) codecArgs(filename string, args ffmpeg.KwArgs) {
+	if strings.ToLower(filepath.Ext(filename)) == ".webm" {
+		args["c:a"] = "libopus"
+		args["b:a"] = "128k"
+		return
+	}
+	args["c:a"] = "aac"
+	args["b:a"] = "192k"
+}
+
+func seconds(value float64) string {
+	return fmt.Sprintf("%.3f", value)
+}
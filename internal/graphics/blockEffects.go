@@ -0,0 +1,134 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// blockEffects - highlight and fade-in of recently placed blocks. The canvas of the render state stays untouched
+// (checkpoints and the final hold need the real blocks), effects are drawn into a copy of the frame
+type blockEffects struct {
+	highlight, fadeIn int // frames, 0 - disabled
+	color             color.RGBA
+	textureSize       int
+	width, height     int // canvas without the footer
+
+	recent map[image.Point]*cellEffect
+	out    []uint8
+	region image.Rectangle // pixels the last apply drew effects over or just stopped drawing them
+}
+
+// cellEffect - when the cell changed and what it looked like before (fade-in blends from it)
+type cellEffect struct {
+	frame  int
+	before []uint8
+}
+
+// newBlockEffects - nil when no effect is enabled
+func newBlockEffects(r frameRender) (*blockEffects, error) {
+	opts := r.effects
+	if opts.Highlight <= 0 && opts.FadeIn <= 0 {
+		return nil, nil
+	}
+	c, err := parseHexColor(opts.HighlightColor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --highlight-color: %w", err)
+	}
+	return &blockEffects{
+		highlight:   max(opts.Highlight, 0),
+		fadeIn:      max(opts.FadeIn, 0),
+		color:       c,
+		textureSize: r.textureSize,
+		width:       r.width,
+		height:      r.height,
+		recent:      make(map[image.Point]*cellEffect),
+		out:         make([]uint8, r.frameHeight()*r.width*3),
+	}, nil
+}
+
+// visible - cells cut off by the canvas edge are skipped
+func (e *blockEffects) visible(cell image.Point) bool {
+	return cell.X >= 0 && cell.Y >= 0 && (cell.X+1)*e.textureSize <= e.width && (cell.Y+1)*e.textureSize <= e.height
+}
+
+// placed - called before the block is drawn over the cell. A cell changed again while still fading keeps its
+// original look, so the fade never starts from a half-blended block
+func (e *blockEffects) placed(pix []uint8, cell image.Point, frame int) {
+	if !e.visible(cell) {
+		return
+	}
+	effect, ok := e.recent[cell]
+	if !ok {
+		effect = &cellEffect{}
+		e.recent[cell] = effect
+	}
+	if e.fadeIn > 0 && (!ok || frame-effect.frame >= e.fadeIn) {
+		effect.before = e.copyCell(effect.before[:0], pix, cell)
+	}
+	effect.frame = frame
+}
+
+func (e *blockEffects) copyCell(dst, pix []uint8, cell image.Point) []uint8 {
+	stride, rowWidth := e.width*3, e.textureSize*3
+	for row := 0; row < e.textureSize; row++ {
+		start := (cell.Y*e.textureSize+row)*stride + cell.X*rowWidth
+		dst = append(dst, pix[start:start+rowWidth]...)
+	}
+	return dst
+}
+
+// apply - frame with the effects of the recent cells, pix itself when nothing is in progress
+func (e *blockEffects) apply(pix []uint8, frame int) []uint8 {
+	e.region = image.Rectangle{}
+	if len(e.recent) == 0 {
+		return pix
+	}
+	copy(e.out, pix)
+	stride, rowWidth := e.width*3, e.textureSize*3
+
+	for cell, effect := range e.recent {
+		e.region = e.region.Union(cellRect(cell, e.textureSize))
+		age := frame - effect.frame
+		if age >= max(e.fadeIn, e.highlight) {
+			delete(e.recent, cell)
+			continue
+		}
+
+		// alpha out of 256: new block over the old one, highlight over both
+		if age < e.fadeIn {
+			alpha := uint32((age + 1) * 256 / (e.fadeIn + 1))
+			for row := 0; row < e.textureSize; row++ {
+				start := (cell.Y*e.textureSize+row)*stride + cell.X*rowWidth
+				before := effect.before[row*rowWidth : (row+1)*rowWidth]
+				for i, from := range before {
+					e.out[start+i] = uint8((uint32(from)*(256-alpha) + uint32(pix[start+i])*alpha) >> 8)
+				}
+			}
+		}
+		if age < e.highlight {
+			e.outline(cell, uint32((e.highlight-age)*256/e.highlight))
+		}
+	}
+	return e.out
+}
+
+// outline - border of the cell tinted with the highlight colour, thicker on large textures so it reads as a glow
+func (e *blockEffects) outline(cell image.Point, alpha uint32) {
+	stride := e.width * 3
+	size := e.textureSize
+	thickness := max(size/8, 1)
+	x0, y0 := cell.X*size, cell.Y*size
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if x >= thickness && x < size-thickness && y >= thickness && y < size-thickness {
+				continue
+			}
+			i := (y0+y)*stride + (x0+x)*3
+			e.out[i] = uint8((uint32(e.out[i])*(256-alpha) + uint32(e.color.R)*alpha) >> 8)
+			e.out[i+1] = uint8((uint32(e.out[i+1])*(256-alpha) + uint32(e.color.G)*alpha) >> 8)
+			e.out[i+2] = uint8((uint32(e.out[i+2])*(256-alpha) + uint32(e.color.B)*alpha) >> 8)
+		}
+	}
+}
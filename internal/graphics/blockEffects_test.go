@@ -0,0 +1,87 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestNewBlockEffects(t *testing.T) {
+	r := frameRender{width: 4, height: 2, textureSize: 2}
+	if e, err := newBlockEffects(r); e != nil || err != nil {
+		t.Errorf("effects %v, %v without --highlight and --fade-in", e, err)
+	}
+	r.effects = entities.EffectOptions{Highlight: 2, HighlightColor: "yellow"}
+	if _, err := newBlockEffects(r); err == nil {
+		t.Error("invalid --highlight-color was accepted")
+	}
+}
+
+func TestBlockEffects(t *testing.T) {
+	// two 2px cells side by side, the left one turns white at frame 0
+	tests := []struct {
+		name    string
+		effects entities.EffectOptions
+		want    [][3]uint8 // left cell pixel in the frames 0, 1, ...
+	}{
+		{"fade-in", entities.EffectOptions{FadeIn: 3, HighlightColor: "#FF0000"}, [][3]uint8{{63, 63, 63}, {127, 127, 127}, {191, 191, 191}, {255, 255, 255}}},
+		{"highlight", entities.EffectOptions{Highlight: 2, HighlightColor: "#FF0000"}, [][3]uint8{{255, 0, 0}, {255, 127, 127}, {255, 255, 255}}},
+		{"both", entities.EffectOptions{Highlight: 1, FadeIn: 1, HighlightColor: "#0000FF"}, [][3]uint8{{0, 0, 255}, {255, 255, 255}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := newBlockEffects(frameRender{width: 4, height: 2, textureSize: 2, effects: tt.effects})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pix := make([]uint8, 4*2*3)
+			e.placed(pix, image.Pt(0, 0), 0)
+			for y := 0; y < 2; y++ {
+				copy(pix[y*12:y*12+6], bytes.Repeat([]uint8{255}, 6))
+			}
+			canvas := bytes.Clone(pix)
+
+			for frame, want := range tt.want {
+				out := e.apply(pix, frame)
+				if got := [3]uint8(out[:3]); got != want {
+					t.Errorf("frame %d: left cell %v, want %v", frame, got, want)
+				}
+				if !bytes.Equal(out[6:12], pix[6:12]) {
+					t.Errorf("frame %d: right cell changed to %v", frame, out[6:12])
+				}
+			}
+			if !bytes.Equal(pix, canvas) {
+				t.Error("effects were drawn into the canvas")
+			}
+			if out := e.apply(pix, len(tt.want)); &out[0] != &pix[0] {
+				t.Error("the canvas is not passed through once the effects ended")
+			}
+		})
+	}
+}
+
+func TestBlockEffectsRepeatedPlacement(t *testing.T) {
+	e, err := newBlockEffects(frameRender{width: 2, height: 2, textureSize: 2, effects: entities.EffectOptions{FadeIn: 3, HighlightColor: "#FF0000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix := make([]uint8, 2*2*3)
+	e.placed(pix, image.Pt(0, 0), 0)
+	for i := range pix {
+		pix[i] = 100
+	}
+	// placed again while fading: the fade keeps blending from the original black, not from the half-blended block
+	e.placed(pix, image.Pt(0, 0), 1)
+	for i := range pix {
+		pix[i] = 200
+	}
+	if got := e.apply(pix, 1)[0]; got != 50 {
+		t.Errorf("pixel %d, want 50 (a quarter of the way from black)", got)
+	}
+	// cells outside of the canvas get no effect
+	e.placed(pix, image.Pt(1, 0), 1)
+	if _, ok := e.recent[image.Pt(1, 0)]; ok {
+		t.Error("effect kept for a cell cut off by the canvas edge")
+	}
+}
@@ -0,0 +1,152 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"image"
+	"maps"
+	"slices"
+)
+
+// keepHistory - cells only need the blocks under the top one when a record removes a block. Without removals the
+// history stays nil and placements are not recorded at all (it would grow with every record of the battle)
+func (s *renderState) keepHistory(dest []entities.VisualData) {
+	if s.history == nil && slices.ContainsFunc(dest, func(block entities.VisualData) bool { return block.Removed }) {
+		s.history = make(map[image.Point][]*entities.Texture)
+	}
+}
+
+// place - records the block in the history of its cell. Returns the texture the cell shows now (nil - empty cell)
+// and false when nothing changed: unknown texture or a removal on an empty cell
+func (s *renderState) place(block entities.VisualData) (image.Point, *entities.Texture, bool) {
+	cell := image.Pt(int(block.X), int(block.Y))
+	if s.history == nil {
+		if block.Removed {
+			return cell, nil, true
+		}
+		tex, ok := s.texture(block.BlockTexture)
+		return cell, tex, ok
+	}
+	stack := s.history[cell]
+
+	if block.Removed {
+		if len(stack) == 0 {
+			return cell, nil, false
+		}
+		stack = stack[:len(stack)-1]
+		if len(stack) == 0 {
+			delete(s.history, cell)
+			return cell, nil, true
+		}
+		s.history[cell] = stack
+		return cell, stack[len(stack)-1], true
+	}
+
+	tex, ok := s.texture(block.BlockTexture)
+	if !ok {
+		return cell, nil, false
+	}
+	s.history[cell] = append(stack, tex)
+	return cell, tex, true
+}
+
+// cellFrame - keeps track of the animated cells, returns what to draw over the cell: the texture (the frame of the
+// tick for animated ones) or nil for the background
+func (r frameRender) cellFrame(state *renderState, cell image.Point, tex *entities.Texture, tick int) *entities.Texture {
+	if tex != nil && tex.Animation != nil && !r.freezeAnimations {
+		state.animated[cell] = tex
+		return animationFrame(tex, tick)
+	}
+	delete(state.animated, cell)
+	return tex
+}
+
+// cellRect - pixels covered by the cell
+func cellRect(cell image.Point, size int) image.Rectangle {
+	return image.Rect(cell.X*size, cell.Y*size, (cell.X+1)*size, (cell.Y+1)*size)
+}
+
+// clearCell - white background over the cell, same bounds checks as blitRGB
+func clearCell(pix []uint8, stride, size, targetX, targetY int) {
+	rowWidth := size * 3
+	for row := 0; row < size; row++ {
+		canvasRowStart := (targetY+row)*stride + (targetX * 3)
+		if canvasRowStart >= 0 && canvasRowStart+rowWidth <= len(pix) {
+			for i := canvasRowStart; i < canvasRowStart+rowWidth; i++ {
+				pix[i] = 255
+			}
+		}
+	}
+}
+
+// reverse - draws every record onto the state, then returns the records undoing them from the last to the first:
+// a placement turns into a removal, a removal places the broken block again. Records that changed nothing stay
+// (as no-ops) so the frame count matches the forward render
+func (r frameRender) reverse(dest []entities.VisualData, state *renderState) []entities.VisualData {
+	// undoing a placement brings back the block under it
+	if state.history == nil {
+		state.history = make(map[image.Point][]*entities.Texture)
+	}
+	names := state.textureNames()
+	tick := videoFrameTick(0, r.framerate)
+	reversed := make([]entities.VisualData, len(dest))
+	var paints []cellPaint
+
+	for i, block := range dest {
+		undo := block
+		undo.BlockTexture = ""
+		undo.Removed = false
+
+		var broken *entities.Texture
+		if stack := state.history[image.Pt(int(block.X), int(block.Y))]; block.Removed && len(stack) > 0 {
+			broken = stack[len(stack)-1]
+		}
+		cell, tex, changed := state.place(block)
+		if changed {
+			paints = append(paints, cellPaint{cell, r.cellFrame(state, cell, tex, tick)})
+			if block.Removed {
+				undo.BlockTexture = names[broken]
+			} else {
+				undo.Removed = true
+			}
+		}
+		reversed[len(dest)-1-i] = undo
+	}
+	r.blitCells(state.pix, paints)
+	return reversed
+}
+
+// texture - texture of the render by its cache name
+func (s *renderState) texture(name string) (*entities.Texture, bool) {
+	if s.textures != nil {
+		tex, ok := s.textures[name]
+		return tex, ok
+	}
+	return getRawTexture(name)
+}
+
+// textureNames - cache name of every texture of the render
+func (s *renderState) textureNames() map[*entities.Texture]string {
+	textures := s.textures
+	if textures == nil {
+		textures = textureCacheRaw
+	}
+	names := make(map[*entities.Texture]string, len(textures))
+	for name, tex := range textures {
+		names[tex] = name
+	}
+	return names
+}
+
+// clone - independent copy, used when the same starting state is rendered more than once
+func (s *renderState) clone() *renderState {
+	c := *s
+	c.pix = slices.Clone(s.pix)
+	c.animated = maps.Clone(s.animated)
+	if s.history != nil {
+		c.history = make(map[image.Point][]*entities.Texture, len(s.history))
+		for cell, stack := range s.history {
+			c.history[cell] = slices.Clip(stack)
+		}
+	}
+	return &c
+}
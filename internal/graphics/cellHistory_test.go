@@ -0,0 +1,128 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestKeepHistory(t *testing.T) {
+	state := &renderState{}
+	state.keepHistory([]entities.VisualData{{BlockTexture: "stone.png"}})
+	if state.history != nil {
+		t.Error("history kept for a render without removals")
+	}
+	state.keepHistory([]entities.VisualData{{BlockTexture: "stone.png"}, {Removed: true}})
+	if state.history == nil {
+		t.Error("no history for a render with removals")
+	}
+}
+
+func TestPlace(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	solidTexture(t, "blue.png", 0, 0, 255)
+	red, blue := textureCacheRaw["red.png"], textureCacheRaw["blue.png"]
+
+	state := &renderState{}
+	state.keepHistory([]entities.VisualData{{Removed: true}})
+	tests := []struct {
+		name    string
+		block   entities.VisualData
+		want    *entities.Texture
+		changed bool
+	}{
+		{"place", entities.VisualData{X: 1, Y: 2, BlockTexture: "red.png"}, red, true},
+		{"place over", entities.VisualData{X: 1, Y: 2, BlockTexture: "blue.png"}, blue, true},
+		{"unknown texture", entities.VisualData{X: 1, Y: 2, BlockTexture: "missing.png"}, nil, false},
+		{"remove the top block", entities.VisualData{X: 1, Y: 2, Removed: true}, red, true},
+		{"remove the last block", entities.VisualData{X: 1, Y: 2, Removed: true}, nil, true},
+		{"remove on an empty cell", entities.VisualData{X: 1, Y: 2, Removed: true}, nil, false},
+	}
+	for _, tt := range tests {
+		cell, tex, changed := state.place(tt.block)
+		if cell != image.Pt(1, 2) || tex != tt.want || changed != tt.changed {
+			t.Errorf("%s: place = %v, %p, %v, want %p, %v", tt.name, cell, tex, changed, tt.want, tt.changed)
+		}
+	}
+	if len(state.history) != 0 {
+		t.Errorf("emptied cell left in the history: %v", state.history)
+	}
+}
+
+func TestPlaceWithoutHistory(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	state := &renderState{}
+	if _, tex, changed := state.place(entities.VisualData{BlockTexture: "red.png"}); tex != textureCacheRaw["red.png"] || !changed {
+		t.Errorf("placement = %p, %v", tex, changed)
+	}
+	if _, tex, changed := state.place(entities.VisualData{Removed: true}); tex != nil || !changed {
+		t.Errorf("removal = %p, %v, want the background", tex, changed)
+	}
+	if state.history != nil {
+		t.Error("place created a history")
+	}
+}
+
+func TestClearCell(t *testing.T) {
+	const width, size = 4, 2
+	pix := make([]uint8, width*width*3)
+	clearCell(pix, width*3, size, 2, 0)
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			want := uint8(0)
+			if x >= 2 && y < 2 {
+				want = 255
+			}
+			if got := pix[(y*width+x)*3]; got != want {
+				t.Errorf("pixel %d,%d = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+	// cells outside of the canvas are left alone instead of panicking
+	clearCell(pix, width*3, size, 0, 3)
+	clearCell(pix, width*3, size, -2, -2)
+}
+
+func TestReverse(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	solidTexture(t, "blue.png", 0, 0, 255)
+	r := frameRender{width: 32, height: 32, textureSize: 16, framerate: 24, workers: 1}
+	dest := []entities.VisualData{
+		{Id: 1, X: 0, Y: 0, BlockTexture: "red.png"},
+		{Id: 2, X: 0, Y: 0, BlockTexture: "blue.png"},
+		{Id: 3, X: 0, Y: 0, Removed: true},
+		{Id: 4, X: 1, Y: 1, Removed: true}, // nothing to remove
+	}
+
+	state := newRenderState(r)
+	reversed := r.reverse(dest, state)
+
+	// the state shows the end of the battle: the red block under the removed blue one
+	if got := state.pix[:3]; !bytes.Equal(got, []uint8{255, 0, 0}) {
+		t.Errorf("cell 0,0 after the forward pass = %v, want red", got)
+	}
+	want := []entities.VisualData{
+		{Id: 4, X: 1, Y: 1},
+		{Id: 3, X: 0, Y: 0, BlockTexture: "blue.png"},
+		{Id: 2, X: 0, Y: 0, Removed: true},
+		{Id: 1, X: 0, Y: 0, Removed: true},
+	}
+	if len(reversed) != len(want) {
+		t.Fatalf("%d reversed records, want %d", len(reversed), len(want))
+	}
+	for i := range want {
+		got := reversed[i]
+		if got.Id != want[i].Id || got.X != want[i].X || got.Y != want[i].Y || got.BlockTexture != want[i].BlockTexture || got.Removed != want[i].Removed {
+			t.Errorf("reversed[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// playing the reversed records empties the canvas again
+	for _, block := range reversed {
+		state.place(block)
+	}
+	if len(state.history) != 0 {
+		t.Errorf("cells left after the reversed playback: %v", state.history)
+	}
+}
@@ -0,0 +1,214 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"maps"
+	"math"
+	"os"
+	"slices"
+)
+
+// Checkpoint layout (little endian):
+//
+//	magic[8] | version u32 | width u32 | frameHeight u32 | textureSize u32 | iterations u32 | framerate u32 |
+//	outputLen u16 | output | frame u32 | lastID i64 | parts u32 | textures u16 | per texture (nameLen u16, name)... |
+//	animated u32 | per cell (x i32, y i32, texture u16)... | history u32 (0xFFFFFFFF - not kept) |
+//	per cell (x i32, y i32, depth u32, texture u16...)... | canvas RGB24 (width*frameHeight*3)
+//
+// textures index the name table, so the history costs two bytes per placement
+const (
+	checkpointMagic   = "TPBCHKPT"
+	checkpointVersion = 3
+)
+
+// noHistory - history count of a render without removals, its cells have no history to restore
+const noHistory uint32 = math.MaxUint32
+
+// renderState - everything needed to continue drawing after the last finished frame
+type renderState struct {
+	frame    int   // frames drawn so far
+	lastID   int64 // id of the last drawn record
+	parts    int   // finished video segments
+	pix      []uint8
+	animated map[image.Point]*entities.Texture
+	history  map[image.Point][]*entities.Texture // blocks placed on the cell, oldest first. Removals restore from it, nil - no removals, see keepHistory
+	textures map[string]*entities.Texture        // textures of this render, nil - the shared cache (--aspect scales copies, see scaledTextures)
+}
+
+func newRenderState(r frameRender) *renderState {
+	pix := make([]uint8, r.frameHeight()*r.width*3)
+	for i := range pix {
+		pix[i] = 255
+	}
+	r.letterbox(pix)
+	return &renderState{
+		pix:      pix,
+		animated: make(map[image.Point]*entities.Texture),
+	}
+}
+
+// CheckpointRecordID - id of the last record drawn before the checkpoint, records up to it do not have to be loaded again
+func CheckpointRecordID(filename string) (int64, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("could not read checkpoint: %w", err)
+	}
+	r := atlasReader{buf: raw}
+	if err = readCheckpointHeader(&r); err != nil {
+		return 0, err
+	}
+	r.bytes(5 * 4) // width, frame height, texture size, iterations, framerate
+	r.bytes(int(r.u16()))
+	r.u32()
+	id := int64(r.u64())
+	if r.err != nil {
+		return 0, errors.New("checkpoint is truncated")
+	}
+	return id, nil
+}
+
+func readCheckpointHeader(r *atlasReader) error {
+	if string(r.bytes(len(checkpointMagic))) != checkpointMagic {
+		return errors.New("not a render checkpoint file")
+	}
+	if v := r.u32(); v != checkpointVersion {
+		return fmt.Errorf("checkpoint version %d is not supported (expected %d)", v, checkpointVersion)
+	}
+	return r.err
+}
+
+// saveCheckpoint - writes the state next to the output, through a temporary file so a crash mid-write keeps the old one
+func saveCheckpoint(r frameRender, state *renderState) error {
+	names := state.textureNames()
+	if len(names) > math.MaxUint16 {
+		return fmt.Errorf("%d textures do not fit into a checkpoint", len(names))
+	}
+	table := slices.Sorted(maps.Values(names))
+	index := make(map[*entities.Texture]uint16, len(names))
+	for tex, name := range names {
+		i, _ := slices.BinarySearch(table, name)
+		index[tex] = uint16(i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(checkpointMagic)
+	for _, v := range []int{checkpointVersion, r.width, r.frameHeight(), r.textureSize, r.iterations, r.framerate} {
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(v)))
+	}
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(r.output))))
+	buf.WriteString(r.output)
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(state.frame)))
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(state.lastID)))
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(state.parts)))
+	buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(table))))
+	for _, name := range table {
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(len(name))))
+		buf.WriteString(name)
+	}
+	buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(state.animated))))
+	for cell, tex := range state.animated {
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(int32(cell.X))))
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(int32(cell.Y))))
+		buf.Write(binary.LittleEndian.AppendUint16(nil, index[tex]))
+	}
+	if state.history == nil {
+		buf.Write(binary.LittleEndian.AppendUint32(nil, noHistory))
+	} else {
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(state.history))))
+	}
+	for cell, stack := range state.history {
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(int32(cell.X))))
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(int32(cell.Y))))
+		buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(stack))))
+		for _, tex := range stack {
+			buf.Write(binary.LittleEndian.AppendUint16(nil, index[tex]))
+		}
+	}
+	buf.Write(state.pix)
+
+	tmp := r.checkpointFile + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("could not write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, r.checkpointFile); err != nil {
+		return fmt.Errorf("could not write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// loadCheckpoint - state saved by saveCheckpoint, refused if the render settings changed since
+func loadCheckpoint(r frameRender) (*renderState, error) {
+	raw, err := os.ReadFile(r.checkpointFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read checkpoint: %w", err)
+	}
+	rd := atlasReader{buf: raw}
+	if err = readCheckpointHeader(&rd); err != nil {
+		return nil, err
+	}
+
+	saved := [5]int{}
+	for i := range saved {
+		saved[i] = int(rd.u32())
+	}
+	output := string(rd.bytes(int(rd.u16())))
+	if rd.err == nil && saved != [5]int{r.width, r.frameHeight(), r.textureSize, r.iterations, r.framerate} {
+		return nil, fmt.Errorf("checkpoint was made with width %d, frame height %d, texture size %d, iterations %d, framerate %d, settings differ now",
+			saved[0], saved[1], saved[2], saved[3], saved[4])
+	}
+	if rd.err == nil && output != r.output {
+		return nil, fmt.Errorf("checkpoint belongs to %s, not %s", output, r.output)
+	}
+
+	state := &renderState{animated: make(map[image.Point]*entities.Texture)}
+	state.frame = int(rd.u32())
+	state.lastID = int64(rd.u64())
+	state.parts = int(rd.u32())
+
+	// textures gone from the assets since the checkpoint are nil, they drop out as if never placed
+	table := make([]*entities.Texture, rd.u16())
+	for i := range table {
+		table[i], _ = getRawTexture(string(rd.bytes(int(rd.u16()))))
+	}
+	texture := func(i uint16) *entities.Texture {
+		if int(i) >= len(table) {
+			rd.err = errors.New("checkpoint texture index out of range")
+			return nil
+		}
+		return table[i]
+	}
+
+	count := int(rd.u32())
+	for i := 0; i < count && rd.err == nil; i++ {
+		cell := image.Pt(int(int32(rd.u32())), int(int32(rd.u32())))
+		if tex := texture(rd.u16()); tex != nil && tex.Animation != nil {
+			state.animated[cell] = tex
+		}
+	}
+	// renders without removals keep no history, saved as noHistory instead of a count
+	if stored := rd.u32(); stored != noHistory {
+		count = int(stored)
+		state.history = make(map[image.Point][]*entities.Texture, count)
+	} else {
+		count = 0
+	}
+	for i := 0; i < count && rd.err == nil; i++ {
+		cell := image.Pt(int(int32(rd.u32())), int(int32(rd.u32())))
+		depth := int(rd.u32())
+		for j := 0; j < depth && rd.err == nil; j++ {
+			if tex := texture(rd.u16()); tex != nil {
+				state.history[cell] = append(state.history[cell], tex)
+			}
+		}
+	}
+	state.pix = rd.bytes(r.width * r.frameHeight() * 3)
+	if rd.err != nil {
+		return nil, errors.New("checkpoint is truncated")
+	}
+	return state, nil
+}
@@ -0,0 +1,141 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+
+	"github.com/vovamod/utils/log"
+)
+
+const (
+	clickSampleRate   = 44100
+	clickLength       = clickSampleRate * 12 / 1000 // 12ms burst
+	maxClicksPerFrame = 5
+)
+
+// writeClickTrack - mono 16-bit WAV with a click per placement burst. Every frame holds the same number of records,
+// so loudness follows placements per real second: a batch placed within a few seconds clicks a lot, a batch spread
+// over an hour stays almost silent. silentFrames (title card, frames drawn before a resume) and tailFrames (hold and
+// stats card) are left silent
+func writeClickTrack(dest []entities.VisualData, spans []frameSpan, framerate, silentFrames, tailFrames int, volume float64) (string, error) {
+	intensity := placementIntensity(spans)
+	totalFrames := silentFrames + len(intensity) + tailFrames
+	totalSamples := frameSample(totalFrames, framerate)
+
+	f, err := os.CreateTemp("", "timelapse-clicks-*.wav")
+	if err != nil {
+		return "", fmt.Errorf("could not create click track: %w", err)
+	}
+	defer func(f *os.File) {
+		err = f.Close()
+		if err != nil {
+			log.Errorf("Error while closing file: %v", err)
+		}
+	}(f)
+	w := bufio.NewWriter(f)
+
+	// RIFF/WAVE header, sizes are known up front
+	dataSize := uint32(totalSamples * 2)
+	header := []byte("RIFF")
+	header = binary.LittleEndian.AppendUint32(header, 36+dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1) // PCM
+	header = binary.LittleEndian.AppendUint16(header, 1) // mono
+	header = binary.LittleEndian.AppendUint32(header, clickSampleRate)
+	header = binary.LittleEndian.AppendUint32(header, clickSampleRate*2)
+	header = binary.LittleEndian.AppendUint16(header, 2)  // block align
+	header = binary.LittleEndian.AppendUint16(header, 16) // bits per sample
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+	w.Write(header)
+
+	// fixed seed, the same data always sounds the same
+	rng := rand.New(rand.NewPCG(uint64(len(dest)), uint64(len(spans))))
+	// clicks started near the end of a frame ring into the next one
+	var buf []float64
+	sample := make([]byte, 2)
+
+	for frame := 0; frame < totalFrames; frame++ {
+		start, end := frameSample(frame, framerate), frameSample(frame+1, framerate)
+		length := end - start
+		if len(buf) < length+clickLength {
+			buf = append(buf, make([]float64, length+clickLength-len(buf))...)
+		}
+
+		if frame >= silentFrames && frame-silentFrames < len(intensity) {
+			// probabilistic rounding keeps quiet moments from going fully silent
+			clicks := intensity[frame-silentFrames] * maxClicksPerFrame
+			count := int(clicks)
+			if rng.Float64() < clicks-float64(count) {
+				count++
+			}
+			for i := 0; i < count; i++ {
+				addClick(buf[rng.IntN(length):], rng, volume)
+			}
+		}
+
+		for _, v := range buf[:length] {
+			binary.LittleEndian.PutUint16(sample, uint16(int16(max(min(v, 1), -1)*math.MaxInt16)))
+			w.Write(sample)
+		}
+		// carry the tail over and clear the rest for the next frame
+		n := copy(buf, buf[length:])
+		clear(buf[n:])
+	}
+
+	if err = w.Flush(); err != nil {
+		return "", fmt.Errorf("could not write click track: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// frameSample - first audio sample of the video frame
+func frameSample(frame, framerate int) int {
+	return frame * clickSampleRate / framerate
+}
+
+// addClick - short sine burst with fast exponential decay, pitch and level vary a bit so bursts do not sound robotic
+func addClick(buf []float64, rng *rand.Rand, volume float64) {
+	freq := 1800 + rng.Float64()*1700
+	amp := volume * (0.5 + rng.Float64()*0.5)
+	for i := 0; i < clickLength && i < len(buf); i++ {
+		t := float64(i) / clickSampleRate
+		buf[i] += amp * math.Exp(-t/0.002) * math.Sin(2*math.Pi*freq*t)
+	}
+}
+
+// placementIntensity - per frame 0..1, records per real second of the frame relative to the busy (90th percentile) rate
+func placementIntensity(spans []frameSpan) []float64 {
+	var rates []float64
+	for _, span := range spans {
+		// reversed records run backwards in time
+		seconds := math.Abs(span.to.Sub(span.from).Seconds())
+		// several placements within the same second are as busy as it gets
+		rates = append(rates, float64(span.end-span.start)/max(seconds, 1))
+	}
+	if len(rates) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(rates)
+	slices.Sort(sorted)
+	busy := sorted[len(sorted)*9/10]
+	if busy == 0 {
+		// paced renders can be mostly empty frames
+		busy = sorted[len(sorted)-1]
+	}
+	if busy == 0 {
+		return rates
+	}
+	for i, rate := range rates {
+		rates[i] = min(rate/busy, 1)
+	}
+	return rates
+}
@@ -0,0 +1,119 @@
+package graphics
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// videoCodecs - ffmpeg encoders of every output codec per encoder family. "cpu" holds software encoders, best first
+var videoCodecs = map[string]map[string][]string{
+	"h264":   {"nvenc": {"h264_nvenc"}, "qsv": {"h264_qsv"}, "vaapi": {"h264_vaapi"}, "amf": {"h264_amf"}, "cpu": {"libx264", "libx264rgb"}},
+	"hevc":   {"nvenc": {"hevc_nvenc"}, "qsv": {"hevc_qsv"}, "vaapi": {"hevc_vaapi"}, "amf": {"hevc_amf"}, "cpu": {"libx265"}},
+	"av1":    {"nvenc": {"av1_nvenc"}, "qsv": {"av1_qsv"}, "vaapi": {"av1_vaapi"}, "amf": {"av1_amf"}, "cpu": {"libsvtav1", "libaom-av1"}},
+	"vp9":    {"qsv": {"vp9_qsv"}, "vaapi": {"vp9_vaapi"}, "cpu": {"libvpx-vp9"}},
+	"prores": {"cpu": {"prores_ks"}},
+	"ffv1":   {"cpu": {"ffv1"}},
+}
+
+// losslessEncoders - software encoder preferred in lossless mode, libx264rgb skips the yuv conversion entirely and
+// libsvtav1 has no lossless mode
+var losslessEncoders = map[string]string{
+	"h264": "libx264rgb",
+	"av1":  "libaom-av1",
+}
+
+// containerCodecs - codecs each output container (picked by file extension) can hold
+var containerCodecs = map[string][]string{
+	".mp4":  {"h264", "hevc", "av1", "vp9"},
+	".mkv":  {"h264", "hevc", "av1", "vp9", "prores", "ffv1"},
+	".webm": {"vp9", "av1"},
+	".mov":  {"h264", "hevc", "prores"},
+}
+
+// ValidateOutput - checks that the output extension is known and its container can hold the codec. Explicit ffmpeg
+// encoders (--encoder=libx265) decide the codec themselves, without --codec the container picks its default
+func ValidateOutput(filename, codec, encoder string) error {
+	// animations, .avi (Motion-JPEG) and png frames (path ending with /) have a fixed format, --codec does not apply
+	if _, ok := animationFormats[strings.ToLower(filepath.Ext(filename))]; ok || !NeedsFFmpeg(filename) {
+		return nil
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		return fmt.Errorf("%s has no extension, use .mp4, .mkv, .webm, .mov, .gif, .apng, .webp, .avi or end it with / for a directory of png frames", filename)
+	}
+	allowed, ok := containerCodecs[ext]
+	if !ok {
+		return fmt.Errorf("unsupported output extension %q, use .mp4, .mkv, .webm, .mov or .gif, .apng, .webp, .avi", ext)
+	}
+
+	if c := codecOfEncoder(strings.ToLower(encoder)); c != "" {
+		codec = c
+	}
+	if codec == "" {
+		return nil
+	}
+	if _, ok := videoCodecs[codec]; !ok {
+		return fmt.Errorf("unknown codec %q", codec)
+	}
+	if !slices.Contains(allowed, codec) {
+		return fmt.Errorf("%s cannot be stored in %s, supported codecs: %s", codec, ext, strings.Join(allowed, ", "))
+	}
+	return nil
+}
+
+// ContainerCodec - codec the file is encoded with: --codec as given (ValidateOutput checked that the container holds
+// it), without one the first codec the container takes. One rule for a single output and for several sharing --codec
+func ContainerCodec(filename, codec string) string {
+	allowed := containerCodecs[strings.ToLower(filepath.Ext(filename))]
+	if codec != "" || len(allowed) == 0 {
+		return codec
+	}
+	return allowed[0]
+}
+
+// SupportsAudio - only the ffmpeg video containers carry a soundtrack, animations, .avi and png frames are silent
+func SupportsAudio(filename string) bool {
+	_, ok := containerCodecs[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+// codecOfEncoder - output codec produced by an ffmpeg encoder, empty if unknown
+func codecOfEncoder(encoder string) string {
+	for codec, families := range videoCodecs {
+		for _, encoders := range families {
+			if slices.Contains(encoders, encoder) {
+				return codec
+			}
+		}
+	}
+	return ""
+}
+
+// cpuCandidates - software encoders of the codec, always the last resort
+func cpuCandidates(codec string, lossless bool) []encoderCandidate {
+	var candidates []encoderCandidate
+	for _, name := range videoCodecs[codec]["cpu"] {
+		preferred := losslessEncoders[codec] == name
+		if name == "libx264rgb" && !lossless {
+			continue
+		}
+		c := encoderCandidate{Codec: name, Name: name, GPUType: "cpu", Format: codec}
+		if lossless && preferred {
+			candidates = append([]encoderCandidate{c}, candidates...)
+		} else {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// hardwareCandidate - encoder of the family for the codec, nil if the family cannot produce it
+func hardwareCandidate(codec, family, gpuType, device string) []encoderCandidate {
+	var candidates []encoderCandidate
+	for _, name := range videoCodecs[codec][family] {
+		candidates = append(candidates, encoderCandidate{Codec: name, Name: family, GPUType: gpuType, Device: device, Format: codec})
+	}
+	return candidates
+}
@@ -0,0 +1,342 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vovamod/utils/log"
+)
+
+// errCompareStopped - the compositor gave up (sink error), tiles stop drawing
+var errCompareStopped = errors.New("compare render stopped")
+
+// compareTile - one record stream of a compare render. It is drawn on its own full canvas on its own goroutine,
+// every frame is scaled into the tile area of the video frame
+type compareTile struct {
+	label  string
+	dest   []entities.VisualData
+	render frameRender
+	spans  []frameSpan
+
+	area   image.Rectangle // tile in the video frame
+	view   image.Rectangle // the scaled canvas inside the tile, the rest is letterbox
+	xs, ys []int           // canvas column/row shown by every column/row of the view
+
+	frames chan []uint8  // frames drawn by the tile, closed after the last one
+	ack    chan struct{} // the frame is copied, the tile may draw the next one
+	err    error         // why the tile stopped, read after frames is closed
+}
+
+// tileSink - hands the frames of a tile to the compositor, one at a time (the tile draws the next one into the same
+// buffer)
+type tileSink struct {
+	tile *compareTile
+	stop <-chan struct{}
+}
+
+func (s tileSink) WriteFrame(pix []uint8) error {
+	select {
+	case s.tile.frames <- pix:
+	case <-s.stop:
+		return errCompareStopped
+	}
+	select {
+	case <-s.tile.ack:
+		return nil
+	case <-s.stop:
+		return errCompareStopped
+	}
+}
+
+func (s tileSink) Close() error {
+	return nil
+}
+
+// EncodeCompare - renders 2-4 record streams side by side, each tile labelled. sync "frame" shows the n-th frame of
+// every stream at once (the streams start together), "time" cuts every stream by one shared clock so the tiles show
+// the same moment
+func EncodeCompare(tiles []entities.CompareTile, width, height, iterations, textureSize, framerate int, filename, sync string, renderTime, debug, freezeAnimations bool, encoderOpts entities.EncoderOptions, cards entities.CardOptions) error {
+	if len(tiles) < 2 || len(tiles) > 4 {
+		return fmt.Errorf("compare needs 2 to 4 tiles, got %d", len(tiles))
+	}
+	dests := make([][]entities.VisualData, len(tiles))
+	for i, tile := range tiles {
+		if len(tile.Data) == 0 {
+			return fmt.Errorf("tile %q has no records", tile.Label)
+		}
+		dests[i] = tile.Data
+	}
+	if _, ok := animationFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		return fmt.Errorf("compare renders cannot be written as %s animations yet, use a video, .avi or a frames directory", filepath.Ext(filename))
+	}
+	quality, err := resolveQuality(encoderOpts)
+	if err != nil {
+		return err
+	}
+
+	uiOffset := 0
+	if renderTime {
+		uiOffset = max(height/10, 40)
+	}
+	render := frameRender{
+		width:       width,
+		height:      height,
+		uiOffset:    uiOffset,
+		iterations:  iterations,
+		textureSize: textureSize,
+		framerate:   framerate,
+		renderTime:  renderTime,
+		output:      filename,
+		cards:       cards,
+		stats:       newCardStats(dests...),
+		workers:     1,
+	}
+
+	// every tile draws the whole canvas, the blit workers are shared between them
+	tileRender := frameRender{
+		width:            width,
+		height:           height,
+		iterations:       iterations,
+		textureSize:      textureSize,
+		framerate:        framerate,
+		freezeAnimations: freezeAnimations,
+		effects:          encoderOpts.Effects,
+		workers:          renderWorkers(encoderOpts.Workers/len(tiles), width, height, textureSize),
+		pace:             encoderOpts.Pace,
+		quiet:            true,
+	}
+	if sync == "time" {
+		tileRender.pace, tileRender.paceOrigin = compareClock(dests, iterations, encoderOpts.Pace)
+		log.Info(fmt.Sprintf("Time sync: %v of real time per frame from %s", tileRender.pace, tileRender.paceOrigin.Format("2006-01-02 15:04")))
+	}
+
+	compare := make([]*compareTile, len(tiles))
+	areas := compareLayout(len(tiles), width, height)
+	frames := 0
+	for i, tile := range tiles {
+		t := &compareTile{label: tile.Label, dest: tile.Data, render: tileRender, area: areas[i]}
+		if err := t.render.checkPace(t.dest); err != nil {
+			return fmt.Errorf("tile %q: %w", t.label, err)
+		}
+		t.spans = t.render.frameSpans(t.dest)
+		t.fit(width, height)
+		frames = max(frames, len(t.spans))
+		compare[i] = t
+		log.Info(fmt.Sprintf("Tile %q: %d records", t.label, len(t.dest)))
+	}
+	if sync == "time" {
+		// streams ending early keep drawing empty frames until the shared clock runs out
+		for _, t := range compare {
+			t.render.minFrames = frames
+			t.spans = t.render.frameSpans(t.dest)
+		}
+	}
+	log.Info(fmt.Sprintf("Rendering %d tiles synchronised by %s, %d frames", len(tiles), sync, frames))
+
+	if encoderOpts.Audio.Clicks {
+		log.Warn("--click-track is not supported by compare renders, ignoring it")
+		encoderOpts.Audio.Clicks = false
+	}
+	audio := newSoundtrack(encoderOpts.Audio, "", render.videoFrames(frames), framerate)
+	target := entities.OutputTarget{File: filename}
+	output, err := render.openOutput(target, &renderState{}, 0, encoderOpts, outputsGPU([]entities.OutputTarget{target}, encoderOpts), quality, audio, debug)
+	if err != nil {
+		return err
+	}
+
+	written, err := render.compose(compare, frames, output.sink)
+	if err != nil {
+		closeSinks(output.sink)
+		return err
+	}
+	if err = output.sink.Close(); err != nil {
+		return err
+	}
+	return output.finish(written)
+}
+
+// compareClock - start and real time per frame shared by all tiles. Without --pace the span of all records is cut
+// into as many frames as the longest stream would get with --iterations
+func compareClock(dests [][]entities.VisualData, iterations int, pace time.Duration) (time.Duration, time.Time) {
+	origin, last := dests[0][0].Time, dests[0][len(dests[0])-1].Time
+	frames := 1
+	for _, dest := range dests {
+		if dest[0].Time.Before(origin) {
+			origin = dest[0].Time
+		}
+		if dest[len(dest)-1].Time.After(last) {
+			last = dest[len(dest)-1].Time
+		}
+		frames = max(frames, (len(dest)+iterations-1)/iterations)
+	}
+	if pace > 0 {
+		return pace, origin
+	}
+	return max(last.Sub(origin)/time.Duration(frames), time.Millisecond), origin
+}
+
+// compareLayout - tile areas: two side by side (stacked on a portrait frame), three or four in a 2x2 grid
+func compareLayout(tiles, width, height int) []image.Rectangle {
+	if tiles == 2 {
+		if width >= height {
+			return []image.Rectangle{image.Rect(0, 0, width/2, height), image.Rect(width/2, 0, width, height)}
+		}
+		return []image.Rectangle{image.Rect(0, 0, width, height/2), image.Rect(0, height/2, width, height)}
+	}
+	areas := make([]image.Rectangle, tiles)
+	for i := range areas {
+		x, y := i%2, i/2
+		areas[i] = image.Rect(x*width/2, y*height/2, (x+1)*width/2, (y+1)*height/2)
+	}
+	return areas
+}
+
+// fit - the canvas scaled down to fit the tile area keeping its aspect, nearest neighbour (blocks stay sharp)
+func (t *compareTile) fit(width, height int) {
+	scale := min(float64(t.area.Dx())/float64(width), float64(t.area.Dy())/float64(height))
+	w, h := max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1)
+	origin := t.area.Min.Add(image.Pt((t.area.Dx()-w)/2, (t.area.Dy()-h)/2))
+	t.view = image.Rectangle{Min: origin, Max: origin.Add(image.Pt(w, h))}
+
+	t.xs = make([]int, w)
+	for x := range t.xs {
+		t.xs[x] = x * width / w
+	}
+	t.ys = make([]int, h)
+	for y := range t.ys {
+		t.ys[y] = y * height / h
+	}
+}
+
+// blit - tile canvas scaled into its view of the video frame
+func (t *compareTile) blit(frame []uint8, frameWidth int, pix []uint8) {
+	stride := t.render.width * 3
+	for y, srcY := range t.ys {
+		dst := frame[((t.view.Min.Y+y)*frameWidth+t.view.Min.X)*3:]
+		src := pix[srcY*stride:]
+		for x, srcX := range t.xs {
+			copy(dst[x*3:x*3+3], src[srcX*3:srcX*3+3])
+		}
+	}
+}
+
+// drawLabel - tile name on a footer coloured box in the top left corner of the tile (over the letterbox when there is
+// one), the time of the stream under it when the tiles are not on one clock
+func (t *compareTile) drawLabel(frame []uint8, frameWidth int, clock string) {
+	lines := []string{t.label}
+	if clock != "" {
+		lines = append(lines, clock)
+	}
+	widest := 1
+	for _, line := range lines {
+		widest = max(widest, getTextWidth(line, 1))
+	}
+	scale := max(1, min(t.area.Dy()/16/13, t.area.Dx()*8/10/widest))
+	padding := 3 * scale
+	lineHeight := 13 * scale
+
+	box := image.Rect(0, 0, widest*scale+2*padding, len(lines)*lineHeight+2*padding).
+		Add(t.area.Min.Add(image.Pt(padding, padding))).Intersect(t.area)
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		row := frame[(y*frameWidth+box.Min.X)*3 : (y*frameWidth+box.Max.X)*3]
+		for i := 0; i < len(row); i += 3 {
+			row[i], row[i+1], row[i+2] = 35, 35, 35
+		}
+	}
+	for i, line := range lines {
+		// addSimpleText positions by a scaled baseline, see cardText
+		y := box.Min.Y + padding + i*lineHeight
+		addSimpleText(frame, box.Min.X+padding, y+11-11*scale/8, line, frameWidth, frameWidth*3, scale)
+	}
+}
+
+// compose - starts the tile goroutines and writes the video: title card, the tiles frame by frame (a finished stream
+// keeps its last frame) and the outro. Returns the number of written frames
+func (r frameRender) compose(tiles []*compareTile, frames int, sink frameSink) (int, error) {
+	stop := make(chan struct{})
+	for _, t := range tiles {
+		t.frames = make(chan []uint8)
+		t.ack = make(chan struct{})
+		go func(t *compareTile) {
+			defer close(t.frames)
+			effects, err := newBlockEffects(t.render)
+			if err != nil {
+				t.err = err
+				return
+			}
+			out := newFrameOutput(tileSink{tile: t, stop: stop}, t.render.width, t.render.frameHeight(), false)
+			state := newRenderState(t.render)
+			state.keepHistory(t.dest)
+			t.err = t.render.drawBatches(t.dest, 1, state, effects, out)
+		}(t)
+	}
+	// tiles blocked on a frame nobody takes anymore return errCompareStopped
+	defer func() {
+		close(stop)
+		for _, t := range tiles {
+			for range t.frames {
+			}
+		}
+	}()
+
+	out := newFrameOutput(sink, r.width, r.frameHeight(), r.pace > 0)
+	if err := r.writeIntro(out, 1); err != nil {
+		return out.frames(), err
+	}
+
+	frame := make([]uint8, r.frameHeight()*r.width*3)
+	for i := range frame {
+		frame[i] = 35
+	}
+	for i := 0; i < frames; i++ {
+		for _, t := range tiles {
+			// a stream with fewer frames holds its last one
+			if i >= len(t.spans) {
+				continue
+			}
+			pix, ok := <-t.frames
+			if !ok {
+				if t.err != nil {
+					return out.frames(), fmt.Errorf("tile %q: %w", t.label, t.err)
+				}
+				return out.frames(), fmt.Errorf("tile %q stopped after %d of %d frames", t.label, i, len(t.spans))
+			}
+			t.blit(frame, r.width, pix)
+			t.ack <- struct{}{}
+
+			clock := ""
+			if r.renderTime && t.render.paceOrigin.IsZero() {
+				clock = t.spans[i].to.Format("2006-01-02 15:04")
+			}
+			t.drawLabel(frame, r.width, clock)
+		}
+
+		if r.renderTime {
+			// tiles on one clock share the footer time, otherwise every label carries its own
+			ts := ""
+			if !tiles[0].render.paceOrigin.IsZero() {
+				ts = tiles[0].spans[i].to.Format("2006-01-02 15:04")
+			}
+			drawFooter(frame, r.width, r.height, r.uiOffset, i+1, ts, "")
+		}
+		if err := out.write(frame, true); err != nil {
+			return out.frames(), err
+		}
+		log.CustomStreamf("info", "Progress: %d/%d frames", i+1, frames)
+	}
+
+	for _, t := range tiles {
+		for range t.frames {
+		}
+		if t.err != nil {
+			return out.frames(), fmt.Errorf("tile %q: %w", t.label, t.err)
+		}
+	}
+	err := r.writeOutro(&renderState{pix: frame}, out, 1)
+	return out.frames(), err
+}
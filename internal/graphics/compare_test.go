@@ -0,0 +1,84 @@
+package graphics
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+func TestCompareLayout(t *testing.T) {
+	tests := []struct {
+		name                 string
+		tiles, width, height int
+		want                 []image.Rectangle
+	}{
+		{"2 landscape", 2, 1920, 1080, []image.Rectangle{image.Rect(0, 0, 960, 1080), image.Rect(960, 0, 1920, 1080)}},
+		{"2 portrait", 2, 1080, 1920, []image.Rectangle{image.Rect(0, 0, 1080, 960), image.Rect(0, 960, 1080, 1920)}},
+		{"3", 3, 1920, 1080, []image.Rectangle{image.Rect(0, 0, 960, 540), image.Rect(960, 0, 1920, 540), image.Rect(0, 540, 960, 1080)}},
+		{"4 odd size", 4, 1921, 1081, []image.Rectangle{
+			image.Rect(0, 0, 960, 540), image.Rect(960, 0, 1921, 540), image.Rect(0, 540, 960, 1081), image.Rect(960, 540, 1921, 1081),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compareLayout(tt.tiles, tt.width, tt.height); !slices.Equal(got, tt.want) {
+				t.Errorf("compareLayout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareTileFit(t *testing.T) {
+	tests := []struct {
+		name          string
+		area          image.Rectangle
+		width, height int
+		view          image.Rectangle
+	}{
+		// half of a landscape frame, a wide canvas is letterboxed above and below
+		{"2 tiles", image.Rect(960, 0, 1920, 1080), 1000, 500, image.Rect(960, 300, 1920, 780)},
+		// quarter of the frame, a portrait canvas is pillarboxed
+		{"3 tiles", image.Rect(0, 540, 960, 1080), 1080, 1920, image.Rect(328, 540, 631, 1080)},
+		{"4 tiles, same aspect", image.Rect(960, 540, 1920, 1080), 1920, 1080, image.Rect(960, 540, 1920, 1080)},
+		{"tiny tile", image.Rect(0, 0, 1, 1), 1000, 10, image.Rect(0, 0, 1, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tile := &compareTile{area: tt.area}
+			tile.fit(tt.width, tt.height)
+			if tile.view != tt.view {
+				t.Errorf("view %v, want %v", tile.view, tt.view)
+			}
+			if !tile.view.In(tile.area) {
+				t.Errorf("view %v outside of the tile %v", tile.view, tile.area)
+			}
+			if len(tile.xs) != tile.view.Dx() || len(tile.ys) != tile.view.Dy() {
+				t.Fatalf("%d columns and %d rows for a %v view", len(tile.xs), len(tile.ys), tile.view)
+			}
+			// nearest neighbour rows and columns stay inside the canvas and in order
+			if tile.xs[0] != 0 || tile.xs[len(tile.xs)-1] >= tt.width || !slices.IsSorted(tile.xs) {
+				t.Errorf("columns %d..%d of a %d wide canvas", tile.xs[0], tile.xs[len(tile.xs)-1], tt.width)
+			}
+			if tile.ys[0] != 0 || tile.ys[len(tile.ys)-1] >= tt.height || !slices.IsSorted(tile.ys) {
+				t.Errorf("rows %d..%d of a %d high canvas", tile.ys[0], tile.ys[len(tile.ys)-1], tt.height)
+			}
+		})
+	}
+}
+
+func TestCompareTileBlit(t *testing.T) {
+	// a 2x1 canvas doubled into a 4x2 view in the middle of a 6x2 frame
+	tile := &compareTile{area: image.Rect(0, 0, 6, 2), render: frameRender{width: 2}}
+	tile.fit(2, 1)
+	frame := make([]uint8, 6*2*3)
+	tile.blit(frame, 6, []uint8{10, 10, 10, 20, 20, 20})
+	for y := 0; y < 2; y++ {
+		var row []uint8
+		for x := 0; x < 6; x++ {
+			row = append(row, frame[(y*6+x)*3])
+		}
+		if want := []uint8{0, 10, 10, 20, 20, 0}; !slices.Equal(row, want) {
+			t.Errorf("row %d = %v, want %v", y, row, want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package graphics
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vovamod/utils/log"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// probeSizes - fallback sizes tried when a hardware encoder refuses the requested one, largest first
+var probeSizes = [][2]int{{4096, 4096}, {3840, 2160}, {1920, 1080}}
+
+const (
+	probeTimeout = 20 * time.Second
+	// probeCacheTTL - stored results older than this are probed again (drivers get updated under the same ffmpeg)
+	probeCacheTTL = 7 * 24 * time.Hour
+	// probeFailureTTL - failures can be transient (busy GPU, driver reload, killed ffmpeg), they are retried soon
+	probeFailureTTL = time.Hour
+)
+
+// probeResult - stored outcome of one test encode
+type probeResult struct {
+	OK bool      `json:"ok"`
+	At time.Time `json:"at"`
+}
+
+// ttl - how long the result is trusted, failures only briefly
+func (r probeResult) ttl() time.Duration {
+	if r.OK {
+		return probeCacheTTL
+	}
+	return probeFailureTTL
+}
+
+var (
+	// probeCache - result of every test encode, keyed by ffmpeg version, encoder, device, pix_fmt, size and
+	// lossless mode. Loaded from
+	// and saved to probeCacheFile so later runs skip the test encodes
+	probeCache     map[string]probeResult
+	probeCacheOnce sync.Once
+	probeMutex     sync.Mutex
+
+	encoderListOnce sync.Once
+	encoderList     string
+	ffmpegVersion   string
+)
+
+// probeCacheFile - the probe results of all runs, empty when the user has no cache directory
+func probeCacheFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "timelapse-pb", "encoder-probes.json")
+}
+
+// probePixFmts - pixel formats the encoder is tried with, preferred first. The quality mode decides what is acceptable:
+// pixel perfect needs full chroma, everything else takes the 4:2:0 formats the family uploads best
+func probePixFmts(enc encoderCandidate, quality qualitySettings) []string {
+	if quality.PixelPerfect {
+		return []string{"yuv444p"}
+	}
+	switch enc.Name {
+	case "nvenc", "amf":
+		return []string{"yuv420p", "nv12"}
+	case "qsv", "vaapi":
+		return []string{"nv12"}
+	default:
+		// software encoders, the special ones (rgb, ffv1, prores) pick their own format
+		return []string{""}
+	}
+}
+
+// probeEncoder - tries a tiny test encode with the same arguments the render would use, in every pixel format the quality
+// mode accepts. Hardware encoders that refuse the requested size are retried with smaller ones, the largest working size
+// is recorded as MaxWidth/MaxHeight
+func probeEncoder(enc encoderCandidate, width, height int, quality qualitySettings) (encoderCandidate, bool) {
+	if !encoderListed(enc.Codec) {
+		log.Debugf("Encoder %s is not built into ffmpeg", enc.Codec)
+		return enc, false
+	}
+
+	pixFmts := probePixFmts(enc, quality)
+	if probed, ok := probePixFmt(enc, pixFmts, width, height, quality); ok {
+		return probed, true
+	}
+	if enc.GPUType == "cpu" {
+		return enc, false
+	}
+
+	full := outputDimensions(enc, width, height, quality)
+	for _, size := range probeSizes {
+		limited := enc
+		limited.MaxWidth, limited.MaxHeight = size[0], size[1]
+		out := outputDimensions(limited, width, height, quality)
+		if out.width == full.width && out.height == full.height {
+			continue
+		}
+		if probed, ok := probePixFmt(limited, pixFmts, width, height, quality); ok {
+			log.Info(fmt.Sprintf("Encoder %s works up to %dx%d, frames will be scaled to %dx%d", enc.Codec, size[0], size[1], out.width, out.height))
+			return probed, true
+		}
+	}
+	return enc, false
+}
+
+// probePixFmt - the encoder with the first pixel format that passes the test encode
+func probePixFmt(enc encoderCandidate, pixFmts []string, width, height int, quality qualitySettings) (encoderCandidate, bool) {
+	for _, pixFmt := range pixFmts {
+		enc.PixFmt = pixFmt
+		if testEncode(enc, width, height, quality) {
+			if pixFmt != "" {
+				log.Debugf("Encoder %s takes %s", enc.Codec, pixFmt)
+			}
+			return enc, true
+		}
+	}
+	return enc, false
+}
+
+// testEncode - encodes a single black rgb24 frame (what the pipe delivers) into the null muxer. Results are cached
+// across runs
+func testEncode(enc encoderCandidate, width, height int, quality qualitySettings) bool {
+	size := outputDimensions(enc, width, height, quality)
+	outputArgs := getEncoderArgs(enc, width, height, quality)
+
+	args := []string{"-hide_banner", "-v", "error",
+		"-f", "lavfi", "-i", fmt.Sprintf("color=c=black:s=%dx%d:r=1,format=rgb24", width, height)}
+	args = append(args, ffmpeg.ConvertKwargsToCmdLineArgs(outputArgs)...)
+	args = append(args, "-frames:v", "1", "-f", "null", "-")
+
+	encoderListed(enc.Codec) // reads the ffmpeg version as well
+	pixFmt, _ := outputArgs["pix_fmt"].(string)
+	key := fmt.Sprintf("%s|%s|%s%s|%s|%dx%d|lossless=%v", ffmpegVersion, enc.Codec, enc.Device, enc.Adapter, cmp.Or(enc.PixFmt, pixFmt), size.width, size.height, quality.Lossless)
+
+	probeMutex.Lock()
+	defer probeMutex.Unlock()
+	probeCacheOnce.Do(loadProbeCache)
+	if result, found := probeCache[key]; found && time.Since(result.At) < result.ttl() {
+		if !result.OK {
+			log.Info(fmt.Sprintf("%s failed its test encode at %dx%d %s ago, skipping it (retried after %s)",
+				enc.Codec, size.width, size.height, time.Since(result.At).Round(time.Second), probeFailureTTL))
+		}
+		return result.OK
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		log.Debugf("Test encode with %s at %dx%d failed: %v %s", enc.Codec, size.width, size.height, err, strings.TrimSpace(string(output)))
+	}
+
+	probeCache[key] = probeResult{OK: err == nil, At: time.Now()}
+	saveProbeCache()
+	return err == nil
+}
+
+// loadProbeCache - results of earlier runs, a missing or broken file starts an empty cache
+func loadProbeCache() {
+	probeCache = make(map[string]probeResult)
+	filename := probeCacheFile()
+	if filename == "" {
+		return
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(raw, &probeCache); err != nil {
+		log.Debugf("Encoder probe cache %s is broken, probing again: %v", filename, err)
+		probeCache = make(map[string]probeResult)
+	}
+}
+
+// saveProbeCache - writes the cache through a temporary file, concurrent runs never see half of it
+func saveProbeCache() {
+	filename := probeCacheFile()
+	if filename == "" {
+		return
+	}
+	raw, err := json.MarshalIndent(probeCache, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	}
+	if err == nil {
+		tmp := fmt.Sprintf("%s.%d.tmp", filename, os.Getpid())
+		if err = os.WriteFile(tmp, raw, 0o644); err == nil {
+			err = os.Rename(tmp, filename)
+		}
+	}
+	if err != nil {
+		log.Debugf("Could not save encoder probe cache %s: %v", filename, err)
+	}
+}
+
+// encoderListed - cheap pre-check against `ffmpeg -encoders` so codecs missing from the build are not test encoded
+func encoderListed(codec string) bool {
+	encoderListOnce.Do(func() {
+		output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
+		if err == nil {
+			encoderList = string(output)
+		}
+		// first line: ffmpeg version N ...
+		output, err = exec.Command("ffmpeg", "-hide_banner", "-version").Output()
+		if err == nil {
+			ffmpegVersion, _, _ = strings.Cut(strings.TrimSpace(string(output)), "\n")
+		}
+	})
+	for _, line := range strings.Split(encoderList, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == codec {
+			return true
+		}
+	}
+	return false
+}
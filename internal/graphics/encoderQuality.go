@@ -0,0 +1,273 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"github.com/vovamod/utils/log"
+)
+
+// qualitySettings - encoder independent quality request, translated per encoder family by applyQuality
+type qualitySettings struct {
+	CRF     int    // constant quality, x264 scale (0-51, lower is better)
+	Preset  string // x264 preset names, ultrafast..veryslow
+	Tune    string // x264 tune names, translated by encoderTunes
+	Bitrate string // target bitrate, e.g. 8M. Empty - constant quality
+	MaxRate string
+
+	PixelPerfect bool
+	Lossless     bool
+	Upscale      int
+
+	Width, Height int // size of the output to fit the frames into, 0 - canvas size (times Upscale)
+}
+
+var qualityProfiles = map[string]qualitySettings{
+	"draft":    {CRF: 30, Preset: "veryfast"},
+	"standard": {CRF: 23, Preset: "medium"},
+	"archive":  {CRF: 16, Preset: "slow"},
+}
+
+var presetNames = []string{"ultrafast", "superfast", "veryfast", "faster", "fast", "medium", "slow", "slower", "veryslow"}
+
+var tuneNames = []string{"film", "animation", "grain", "stillimage", "fastdecode", "zerolatency", "psnr", "ssim"}
+
+// encoderTunes - --tune translated to the options of every encoder family (software encoders by name) that has an
+// equivalent. An encoder without one encodes without the tune, newVideoOutput warns about it
+var encoderTunes = map[string]map[string]ffmpeg.KwArgs{
+	"libx264":    x264Tunes(tuneNames...),
+	"libx264rgb": x264Tunes(tuneNames...),
+	"libx265":    x264Tunes("animation", "grain", "fastdecode", "zerolatency", "psnr", "ssim"),
+	"libsvtav1": {
+		"psnr":       {"svtav1-params": "tune=1"},
+		"fastdecode": {"svtav1-params": "fast-decode=1"},
+		"grain":      {"svtav1-params": "film-grain=8"},
+	},
+	"libaom-av1": {"psnr": {"tune": "psnr"}, "ssim": {"tune": "ssim"}},
+	// screen content tools fit flat shaded blocks the way x264 animation does
+	"libvpx-vp9": {"film": {"tune-content": "film"}, "animation": {"tune-content": "screen"}, "psnr": {"tune": "psnr"}},
+	// nvenc only knows quality and latency tunings, every quality oriented tune is its hq
+	"nvenc": {
+		"film": {"tune": "hq"}, "animation": {"tune": "hq"}, "grain": {"tune": "hq"}, "stillimage": {"tune": "hq"},
+		"psnr": {"tune": "hq"}, "ssim": {"tune": "hq"}, "zerolatency": {"tune": "ull"},
+	},
+	"amf": {"zerolatency": {"usage": "ultralowlatency"}},
+}
+
+// x264Tunes - tunes passed through as -tune, x264 and x265 share the names
+func x264Tunes(names ...string) map[string]ffmpeg.KwArgs {
+	tunes := make(map[string]ffmpeg.KwArgs, len(names))
+	for _, name := range names {
+		tunes[name] = ffmpeg.KwArgs{"tune": name}
+	}
+	return tunes
+}
+
+// tuneArgs - options of the encoder for the tune, false when it has no equivalent
+func tuneArgs(enc encoderCandidate, tune string) (ffmpeg.KwArgs, bool) {
+	args, ok := encoderTunes[enc.Name][tune]
+	return args, ok
+}
+
+// resolveQuality - profile defaults overridden by explicit --crf/--preset/--bitrate/--maxrate/--tune
+func resolveQuality(opts entities.EncoderOptions) (qualitySettings, error) {
+	profile := opts.Quality
+	if profile == "" {
+		profile = "standard"
+	}
+	q, ok := qualityProfiles[profile]
+	if !ok {
+		return q, fmt.Errorf("unknown quality profile %q (draft, standard, archive)", profile)
+	}
+
+	if opts.CRF >= 0 {
+		if opts.CRF > 51 {
+			return q, fmt.Errorf("crf %d is out of range 0-51", opts.CRF)
+		}
+		q.CRF = opts.CRF
+	}
+	if opts.Preset != "" {
+		if presetIndex(opts.Preset) < 0 {
+			return q, fmt.Errorf("unknown preset %q (%s)", opts.Preset, strings.Join(presetNames, ", "))
+		}
+		q.Preset = opts.Preset
+	}
+	if opts.Tune != "" && !slices.Contains(tuneNames, opts.Tune) {
+		return q, fmt.Errorf("unknown tune %q (%s)", opts.Tune, strings.Join(tuneNames, ", "))
+	}
+	q.Tune = opts.Tune
+	q.Bitrate = opts.Bitrate
+	q.MaxRate = opts.MaxRate
+
+	if opts.Upscale < 0 || opts.Upscale > 16 {
+		return q, fmt.Errorf("upscale factor %d is out of range 0-16 (0 or 1 - no upscale)", opts.Upscale)
+	}
+	q.Upscale = opts.Upscale
+	q.Lossless = opts.Lossless || opts.Codec == "ffv1"
+	q.PixelPerfect = opts.PixelPerfect || q.Lossless
+	if q.Lossless && q.Bitrate != "" {
+		return q, errors.New("--bitrate cannot be combined with lossless encoding")
+	}
+	if q.Lossless && q.Tune != "" {
+		return q, errors.New("--tune cannot be combined with lossless encoding, lossless modes bring their own tuning")
+	}
+	return q, nil
+}
+
+func presetIndex(preset string) int {
+	for i, name := range presetNames {
+		if name == preset {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyQuality - writes quality arguments using the option names of the encoder family
+func applyQuality(args ffmpeg.KwArgs, enc encoderCandidate, q qualitySettings) {
+	speed := presetIndex(q.Preset) // 0 fastest - 8 slowest
+	crf := strconv.Itoa(q.CRF)
+	if q.Lossless {
+		applyLossless(args, enc, speed)
+		return
+	}
+
+	switch enc.Name {
+	case "nvenc":
+		// p1 (fastest) - p7 (slowest)
+		args["preset"] = fmt.Sprintf("p%d", 1+speed*6/8)
+		args["rc"] = "vbr"
+		args["cq"] = crf
+		if q.Bitrate == "" {
+			// without it nvenc caps constant quality at its default 2M target
+			args["b:v"] = "0"
+		}
+	case "amf":
+		args["quality"] = [...]string{"speed", "speed", "speed", "balanced", "balanced", "balanced", "quality", "quality", "quality"}[speed]
+		if q.Bitrate == "" {
+			args["rc"] = "cqp"
+			args["qp_i"] = crf
+			args["qp_p"] = crf
+			args["qp_b"] = crf
+		} else {
+			args["rc"] = "vbr_peak"
+		}
+	case "qsv":
+		// qsv knows veryfast..veryslow
+		args["preset"] = presetNames[max(speed, 2)]
+		if q.Bitrate == "" {
+			args["global_quality"] = crf
+		}
+	case "vaapi":
+		if q.Bitrate == "" {
+			args["rc_mode"] = "CQP"
+			args["qp"] = crf
+		} else {
+			args["rc_mode"] = "VBR"
+		}
+	case "libsvtav1":
+		// preset 12 (fastest) - 4, crf on the av1 scale
+		args["preset"] = strconv.Itoa(12 - speed)
+		if q.Bitrate == "" {
+			args["crf"] = av1CRF(q.CRF)
+		}
+	case "libaom-av1":
+		args["cpu-used"] = strconv.Itoa(8 - speed)
+		args["row-mt"] = "1"
+		if q.Bitrate == "" {
+			args["crf"] = av1CRF(q.CRF)
+			args["b:v"] = "0"
+		}
+	case "libvpx-vp9":
+		args["deadline"] = "good"
+		args["cpu-used"] = strconv.Itoa(5 - speed*5/8)
+		args["row-mt"] = "1"
+		if q.Bitrate == "" {
+			args["crf"] = av1CRF(q.CRF)
+			args["b:v"] = "0"
+		}
+	case "prores_ks":
+		// 0 proxy, 2 standard, 3 HQ. Prores has no rate control beyond the profile
+		switch {
+		case q.CRF >= 28:
+			args["profile:v"] = "0"
+		case q.CRF >= 20:
+			args["profile:v"] = "2"
+		default:
+			args["profile:v"] = "3"
+		}
+	default: // libx264, libx265 and others with x264 style options
+		args["preset"] = q.Preset
+		if q.Bitrate == "" {
+			args["crf"] = crf
+		}
+	}
+	if extra, ok := tuneArgs(enc, q.Tune); ok {
+		for key, value := range extra {
+			args[key] = value
+		}
+	}
+
+	if q.Bitrate != "" {
+		args["b:v"] = q.Bitrate
+	}
+	if q.MaxRate != "" {
+		args["maxrate"] = q.MaxRate
+		args["bufsize"] = doubleRate(q.MaxRate)
+	}
+}
+
+// applyLossless - lossless mode of the encoder, rate control options are left out since they only make it lossy again
+func applyLossless(args ffmpeg.KwArgs, enc encoderCandidate, speed int) {
+	switch enc.Name {
+	case "nvenc":
+		args["preset"] = fmt.Sprintf("p%d", 1+speed*6/8)
+		args["tune"] = "lossless"
+	case "libx264", "libx264rgb":
+		args["preset"] = presetNames[speed]
+		args["qp"] = "0"
+	case "libx265":
+		args["preset"] = presetNames[speed]
+		args["x265-params"] = "lossless=1"
+	case "libaom-av1":
+		args["cpu-used"] = strconv.Itoa(8 - speed)
+		args["row-mt"] = "1"
+		args["aom-params"] = "lossless=1"
+	case "libvpx-vp9":
+		args["deadline"] = "good"
+		args["cpu-used"] = strconv.Itoa(5 - speed*5/8)
+		args["row-mt"] = "1"
+		args["lossless"] = "1"
+	case "prores_ks":
+		// 4444 profile, visually lossless at best - prores has no true lossless mode
+		args["profile:v"] = "4"
+	case "ffv1":
+		// every frame is a keyframe, v3 slices with crc so a damaged file stays seekable
+		args["level"] = "3"
+		args["g"] = "1"
+		args["slicecrc"] = "1"
+	default:
+		log.Warn(fmt.Sprintf("%s has no lossless mode, encoding at the best quality it supports", enc.Codec))
+		args["qp"] = "0"
+	}
+}
+
+// av1CRF - x264 crf (0-51) moved to the 0-63 scale used by av1 and vp9 encoders
+func av1CRF(crf int) string {
+	return strconv.Itoa(crf * 63 / 51)
+}
+
+// doubleRate - "8M" -> "16M", buffer of two seconds at maxrate. Unparsable values are returned as is
+func doubleRate(rate string) string {
+	number := strings.TrimRight(rate, "kKmMgG")
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return rate
+	}
+	return strconv.FormatFloat(value*2, 'f', -1, 64) + rate[len(number):]
+}
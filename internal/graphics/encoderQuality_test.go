@@ -0,0 +1,86 @@
+package graphics
+
+import (
+	"maps"
+	"testing"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+func TestApplyQuality(t *testing.T) {
+	standard := qualitySettings{CRF: 23, Preset: "medium"}
+	withBitrate := qualitySettings{CRF: 23, Preset: "medium", Bitrate: "8M", MaxRate: "10M"}
+	tests := []struct {
+		name    string
+		enc     encoderCandidate
+		quality qualitySettings
+		want    ffmpeg.KwArgs
+	}{
+		{"libx264", encoderCandidate{Name: "libx264", Codec: "libx264"}, standard,
+			ffmpeg.KwArgs{"preset": "medium", "crf": "23"}},
+		{"libx264 bitrate", encoderCandidate{Name: "libx264", Codec: "libx264"}, withBitrate,
+			ffmpeg.KwArgs{"preset": "medium", "b:v": "8M", "maxrate": "10M", "bufsize": "20M"}},
+		{"libx264 tune", encoderCandidate{Name: "libx264", Codec: "libx264"}, qualitySettings{CRF: 18, Preset: "slow", Tune: "animation"},
+			ffmpeg.KwArgs{"preset": "slow", "crf": "18", "tune": "animation"}},
+		{"nvenc", encoderCandidate{Name: "nvenc", Codec: "h264_nvenc"}, standard,
+			ffmpeg.KwArgs{"preset": "p4", "rc": "vbr", "cq": "23", "b:v": "0"}},
+		{"nvenc bitrate", encoderCandidate{Name: "nvenc", Codec: "hevc_nvenc"}, withBitrate,
+			ffmpeg.KwArgs{"preset": "p4", "rc": "vbr", "cq": "23", "b:v": "8M", "maxrate": "10M", "bufsize": "20M"}},
+		{"nvenc animation tune", encoderCandidate{Name: "nvenc", Codec: "h264_nvenc"}, qualitySettings{CRF: 23, Preset: "medium", Tune: "animation"},
+			ffmpeg.KwArgs{"preset": "p4", "rc": "vbr", "cq": "23", "b:v": "0", "tune": "hq"}},
+		{"amf", encoderCandidate{Name: "amf", Codec: "h264_amf"}, standard,
+			ffmpeg.KwArgs{"quality": "balanced", "rc": "cqp", "qp_i": "23", "qp_p": "23", "qp_b": "23"}},
+		{"qsv", encoderCandidate{Name: "qsv", Codec: "h264_qsv"}, qualitySettings{CRF: 23, Preset: "ultrafast"},
+			ffmpeg.KwArgs{"preset": "veryfast", "global_quality": "23"}},
+		{"qsv tune without equivalent", encoderCandidate{Name: "qsv", Codec: "h264_qsv"}, qualitySettings{CRF: 23, Preset: "medium", Tune: "animation"},
+			ffmpeg.KwArgs{"preset": "medium", "global_quality": "23"}},
+		{"vaapi", encoderCandidate{Name: "vaapi", Codec: "h264_vaapi"}, standard,
+			ffmpeg.KwArgs{"rc_mode": "CQP", "qp": "23"}},
+		{"vaapi bitrate", encoderCandidate{Name: "vaapi", Codec: "h264_vaapi"}, qualitySettings{CRF: 23, Preset: "medium", Bitrate: "8M"},
+			ffmpeg.KwArgs{"rc_mode": "VBR", "b:v": "8M"}},
+		{"libsvtav1", encoderCandidate{Name: "libsvtav1", Codec: "libsvtav1"}, standard,
+			ffmpeg.KwArgs{"preset": "7", "crf": "28"}},
+		{"libaom-av1", encoderCandidate{Name: "libaom-av1", Codec: "libaom-av1"}, standard,
+			ffmpeg.KwArgs{"cpu-used": "3", "row-mt": "1", "crf": "28", "b:v": "0"}},
+		{"libvpx-vp9 animation tune", encoderCandidate{Name: "libvpx-vp9", Codec: "libvpx-vp9"}, qualitySettings{CRF: 23, Preset: "medium", Tune: "animation"},
+			ffmpeg.KwArgs{"deadline": "good", "cpu-used": "2", "row-mt": "1", "crf": "28", "b:v": "0", "tune-content": "screen"}},
+		{"prores", encoderCandidate{Name: "prores_ks", Codec: "prores_ks"}, qualitySettings{CRF: 16, Preset: "slow"},
+			ffmpeg.KwArgs{"profile:v": "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := ffmpeg.KwArgs{}
+			applyQuality(args, tt.enc, tt.quality)
+			if !maps.Equal(args, tt.want) {
+				t.Errorf("applyQuality = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyLossless(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  encoderCandidate
+		want ffmpeg.KwArgs
+	}{
+		{"nvenc", encoderCandidate{Name: "nvenc", Codec: "h264_nvenc"}, ffmpeg.KwArgs{"preset": "p4", "tune": "lossless"}},
+		{"libx264rgb", encoderCandidate{Name: "libx264rgb", Codec: "libx264rgb"}, ffmpeg.KwArgs{"preset": "medium", "qp": "0"}},
+		{"libx265", encoderCandidate{Name: "libx265", Codec: "libx265"}, ffmpeg.KwArgs{"preset": "medium", "x265-params": "lossless=1"}},
+		{"libaom-av1", encoderCandidate{Name: "libaom-av1", Codec: "libaom-av1"}, ffmpeg.KwArgs{"cpu-used": "3", "row-mt": "1", "aom-params": "lossless=1"}},
+		{"libvpx-vp9", encoderCandidate{Name: "libvpx-vp9", Codec: "libvpx-vp9"}, ffmpeg.KwArgs{"deadline": "good", "cpu-used": "2", "row-mt": "1", "lossless": "1"}},
+		{"prores", encoderCandidate{Name: "prores_ks", Codec: "prores_ks"}, ffmpeg.KwArgs{"profile:v": "4"}},
+		{"ffv1", encoderCandidate{Name: "ffv1", Codec: "ffv1"}, ffmpeg.KwArgs{"level": "3", "g": "1", "slicecrc": "1"}},
+		{"no lossless mode", encoderCandidate{Name: "qsv", Codec: "h264_qsv"}, ffmpeg.KwArgs{"qp": "0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := ffmpeg.KwArgs{}
+			// lossless wins over crf, bitrate and tune
+			applyQuality(args, tt.enc, qualitySettings{CRF: 23, Preset: "medium", Lossless: true, Tune: "film"})
+			if !maps.Equal(args, tt.want) {
+				t.Errorf("lossless args = %v, want %v", args, tt.want)
+			}
+		})
+	}
+}
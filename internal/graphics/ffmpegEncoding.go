@@ -5,9 +5,11 @@ import (
 	"Timelapse-PixelBattle/pkg/entities"
 	"bufio"
 	"fmt"
+	"image"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -16,26 +18,23 @@ import (
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-// getMaxResolution - maximum size of h264/x264 encode with vaapi
-func getMaxResolution(gpuType string) (int, int) {
-	switch gpuType {
-	case "nvidia":
-		return 4096, 4096
-	case "amd_discrete":
-		return 4096, 4096
-	case "amd_integrated":
-		return 3840, 2160
-	case "intel_integrated":
-		return 3840, 2160
-	default:
-		return 1920, 1080
-	}
-}
+// encoderCandidate - ffmpeg encoder that may be used for the render, verified by probeEncoder before use
+type encoderCandidate struct {
+	Codec   string // ffmpeg encoder, e.g. h264_nvenc
+	Name    string // family used by getEncoderArgs: nvenc, amf, qsv, vaapi or the software encoder name
+	GPUType string
+	Device  string // vaapi/qsv render node
+	Adapter string // nvenc -gpu / amf d3d11 adapter index of the GPU picked by the user, empty - driver default
+	PixFmt  string // pixel format the probe found working, empty - the default of the quality mode
+	Format  string // output codec: h264, hevc, av1, vp9, prores
 
-func calculateScaledDimensions(width, height int, gpuType string) (int, int) {
-	maxWidth, maxHeight := getMaxResolution(gpuType)
+	// largest frame the probe managed to encode, 0 - not limited (CPU encoders)
+	MaxWidth  int
+	MaxHeight int
+}
 
-	if width <= maxWidth && height <= maxHeight {
+func calculateScaledDimensions(width, height, maxWidth, maxHeight int) (int, int) {
+	if maxWidth <= 0 || maxHeight <= 0 || (width <= maxWidth && height <= maxHeight) {
 		return width, height
 	}
 
@@ -52,12 +51,15 @@ func calculateScaledDimensions(width, height int, gpuType string) (int, int) {
 		scaledHeight--
 	}
 
-	log.Info(fmt.Sprintf("Scaling from %dx%d to %dx%d for %s compatibility",
-		width, height, scaledWidth, scaledHeight, gpuType))
-
 	return scaledWidth, scaledHeight
 }
 
+// fitDimensions - size scaled up or down to fit into maxWidth x maxHeight keeping the aspect, even for yuv420
+func fitDimensions(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := minFloat(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	return max(int(float64(width)*scale)&^1, 2), max(int(float64(height)*scale)&^1, 2)
+}
+
 // minFloat - helper
 func minFloat(a, b float64) float64 {
 	if a < b {
@@ -67,151 +69,527 @@ func minFloat(a, b float64) float64 {
 }
 
 // getGPUEncoder - uses Best GPU encoder IF available for ffmpeg (prime-run can fail.)
-func getGPUEncoder(width, height int) (string, string, string) {
-	allGPUs := common.GetAvailableGPUs()
+// The GPU was chosen once for the render by selectGPU. Every candidate is probed with a
+// test encode, the first working one wins and the software encoder of the codec is the last resort
+func getGPUEncoder(width, height int, opts entities.EncoderOptions, gpus gpuSelection, quality qualitySettings) encoderCandidate {
+	codec := opts.Codec
+	if codec == "" {
+		codec = "h264"
+	}
+	candidates := encoderCandidates(width, height, codec, opts, gpus, quality.Lossless)
+	if quality.PixelPerfect {
+		// only nvenc h264/hevc take yuv444p (and do lossless), other hardware encoders are 4:2:0 only
+		candidates = slices.DeleteFunc(candidates, func(c encoderCandidate) bool {
+			return c.GPUType != "cpu" && (c.Name != "nvenc" || (c.Format != "h264" && c.Format != "hevc"))
+		})
+	}
+	for _, c := range candidates {
+		if c.Name == "vaapi" {
+			// flag wins over the detected render node
+			if opts.VAAPIDevice != "" {
+				c.Device = opts.VAAPIDevice
+			}
+			if c.Device == "" {
+				c.Device = "/dev/dri/renderD128"
+			}
+		}
+		if probed, ok := probeEncoder(c, width, height, quality); ok {
+			return probed
+		}
+		log.Warn(fmt.Sprintf("Encoder %s failed the test encode, trying next one", c.Codec))
+	}
 
-	if len(allGPUs) == 0 {
-		return "libx264", "libx264", "cpu"
+	fallback := cpuCandidates(codec, quality.Lossless)[0]
+	log.Warn("No working encoder found in candidates, defaulting to " + fallback.Codec)
+	return fallback
+}
+
+// gpuSelection - GPUs of the machine and the one picked by --gpu-index or the prompt. Resolved once per render, every
+// output of it encodes on the same GPU
+type gpuSelection struct {
+	all      []entities.GPU
+	selected *entities.GPU
+	cpu      bool // software encoding chosen at the prompt
+}
+
+// gpuByName - the GPU with the name, or the only one whose name contains it ("4090" for "NVIDIA GeForce RTX 4090")
+func gpuByName(all []entities.GPU, input string) *entities.GPU {
+	for i, g := range all {
+		if strings.EqualFold(g.Name, input) {
+			return &all[i]
+		}
+	}
+	var found *entities.GPU
+	for i, g := range all {
+		if strings.Contains(strings.ToLower(g.Name), strings.ToLower(input)) {
+			if found != nil {
+				return nil
+			}
+			found = &all[i]
+		}
 	}
+	return found
+}
 
-	log.Info("Detected GPUs:")
-	for i, g := range allGPUs {
-		log.Infof("  [%d] %s (%s) - Integrated: %v", i+1, g.Name, g.Vendor, g.IsIntegrated)
-	}
-	log.Info("Select a GPU by number or name (0 for CPU, Leave empty for auto-selection):")
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
-	input = strings.TrimSpace(input)
-	if input == "0" || strings.EqualFold(input, "cpu") {
-		log.Warn("User selected Software Encoder. Proceeding with libx264.")
-		return "libx264", "libx264", "cpu"
-	}
-	var selectedGPU *entities.GPU
-
-	if input != "" {
-		if idx, err := strconv.Atoi(input); err == nil && idx > 0 && idx <= len(allGPUs) {
-			selectedGPU = &allGPUs[idx-1]
+// selectGPU - detects the GPUs and asks for one when nothing was chosen with flags and stdin is a terminal. Explicit
+// ffmpeg encoders and --encoder=cpu need no GPU
+func selectGPU(opts entities.EncoderOptions) gpuSelection {
+	choice := strings.ToLower(strings.TrimSpace(opts.Encoder))
+	switch choice {
+	case "", "auto", "nvenc", "qsv", "vaapi", "amf":
+	default:
+		return gpuSelection{}
+	}
+
+	gpus := gpuSelection{all: common.GetAvailableGPUs()}
+	if opts.GPUIndex > 0 {
+		if opts.GPUIndex <= len(gpus.all) {
+			gpus.selected = &gpus.all[opts.GPUIndex-1]
 		} else {
-			for _, g := range allGPUs {
-				if strings.EqualFold(g.Name, input) {
-					selectedGPU = &g
-					break
-				}
+			log.Warn(fmt.Sprintf("--gpu-index %d is out of range, %d GPUs detected", opts.GPUIndex, len(gpus.all)))
+		}
+	}
+	if (choice != "" && choice != "auto") || len(gpus.all) == 0 {
+		return gpus
+	}
+
+	log.Info("Detected GPUs:")
+	for i, g := range gpus.all {
+		log.Infof("  [%d] %s (%s) - Integrated: %v Driver: %s %s", i+1, g.Name, g.Vendor, g.IsIntegrated, g.Driver, g.RenderNode)
+	}
+
+	if gpus.selected == nil && isInteractive() {
+		log.Info("Select a GPU by number or name (0 for CPU, Leave empty for auto-selection):")
+		reader := bufio.NewReader(os.Stdin)
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "0" || strings.EqualFold(input, "cpu") {
+			gpus.cpu = true
+			return gpus
+		}
+
+		if input != "" {
+			if idx, err := strconv.Atoi(input); err == nil && idx > 0 && idx <= len(gpus.all) {
+				gpus.selected = &gpus.all[idx-1]
+			} else if gpus.selected = gpuByName(gpus.all, input); gpus.selected == nil {
+				log.Warn(fmt.Sprintf("No single GPU is named %q, selecting automatically", input))
 			}
 		}
 	}
+	if gpus.selected != nil {
+		log.Successf("User selected: %s", gpus.selected.Name)
+	}
+	return gpus
+}
 
-	if selectedGPU != nil {
-		codec, encoder, gpuType := resolveEncoderForGPU(*selectedGPU)
-		log.Successf("User selected: %s. Using encoder: %s", selectedGPU.Name, encoder)
-		return codec, encoder, gpuType
+// encoderCandidates - encoders to try for the codec, most preferred first
+func encoderCandidates(width, height int, codec string, opts entities.EncoderOptions, gpus gpuSelection, lossless bool) []encoderCandidate {
+	choice := strings.ToLower(strings.TrimSpace(opts.Encoder))
+	switch choice {
+	case "cpu":
+		log.Info("CPU encoder requested. Proceeding with " + cpuCandidates(codec, lossless)[0].Codec)
+		return cpuCandidates(codec, lossless)
+	case "", "auto", "nvenc", "qsv", "vaapi", "amf":
+	default:
+		// explicit ffmpeg codec, family is taken from its suffix. The codec of an encoder missing from videoCodecs
+		// (mpeg4, libxvid, ...) is not known, the written file is then not checked for one
+		encoderName, gpuType := encoderFamily(choice)
+		format := codecOfEncoder(choice)
+		if format != "" {
+			codec = format
+		}
+		log.Infof("Using encoder %s requested by --encoder", choice)
+		return append([]encoderCandidate{{Codec: choice, Name: encoderName, GPUType: gpuType, Format: format}}, cpuCandidates(codec, lossless)...)
+	}
+
+	if choice == "nvenc" || choice == "qsv" || choice == "vaapi" || choice == "amf" {
+		log.Infof("Using %s family requested by --encoder", choice)
+		return append(resolveEncoderForFamily(choice, gpus.selected, gpus.all, codec), cpuCandidates(codec, lossless)...)
+	}
+	if gpus.cpu {
+		log.Warn("User selected Software Encoder. Proceeding with " + cpuCandidates(codec, lossless)[0].Codec)
+		return cpuCandidates(codec, lossless)
+	}
+	if len(gpus.all) == 0 {
+		return cpuCandidates(codec, lossless)
+	}
+	if gpus.selected != nil {
+		return append(pinGPU(resolveEncoderForGPU(*gpus.selected, codec), *gpus.selected, gpus.all), cpuCandidates(codec, lossless)...)
 	}
 
 	log.Info("Proceeding with automated selection...")
-	for _, g := range allGPUs {
+	var candidates []encoderCandidate
+	for _, g := range gpus.all {
 		if g.Vendor == "nvidia" {
-			return resolveEncoderForGPU(g)
+			candidates = append(candidates, resolveEncoderForGPU(g, codec)...)
 		}
 	}
 
-	for _, g := range allGPUs {
+	for _, g := range gpus.all {
 		if g.Vendor == "amd" && !g.IsIntegrated {
-			return resolveEncoderForGPU(g)
+			candidates = append(candidates, resolveEncoderForGPU(g, codec)...)
 		}
 	}
 
 	if width <= 3840 && height <= 2160 {
-		for _, g := range allGPUs {
+		for _, g := range gpus.all {
 			if g.IsIntegrated {
-				return resolveEncoderForGPU(g)
+				candidates = append(candidates, resolveEncoderForGPU(g, codec)...)
+			}
+		}
+	}
+
+	return append(candidates, cpuCandidates(codec, lossless)...)
+}
+
+// isInteractive - false for cron jobs, pipes and containers without a tty, the GPU prompt would hang there
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// encoderFamily - encoderName and gpuType of an explicit ffmpeg codec name
+func encoderFamily(codec string) (string, string) {
+	switch {
+	case strings.HasSuffix(codec, "_nvenc"):
+		return "nvenc", "nvidia"
+	case strings.HasSuffix(codec, "_qsv"):
+		return "qsv", "intel_integrated"
+	case strings.HasSuffix(codec, "_vaapi"):
+		return "vaapi", "intel_integrated"
+	case strings.HasSuffix(codec, "_amf"):
+		return "amf", "amd_discrete"
+	default:
+		return codec, "cpu"
+	}
+}
+
+// resolveEncoderForFamily - encoder of the requested family for the codec, gpuType follows the selected (or first
+// matching) GPU
+func resolveEncoderForFamily(family string, selected *entities.GPU, allGPUs []entities.GPU, codec string) []encoderCandidate {
+	gpu := selected
+	if gpu == nil {
+		vendor := map[string]string{"nvenc": "nvidia", "qsv": "intel", "amf": "amd"}[family]
+		for i := range allGPUs {
+			if vendor == "" || allGPUs[i].Vendor == vendor {
+				gpu = &allGPUs[i]
+				break
+			}
+		}
+	}
+
+	switch family {
+	case "nvenc", "qsv", "amf":
+		gpuType := map[string]string{"nvenc": "nvidia", "qsv": "intel_integrated", "amf": "amd_discrete"}[family]
+		candidates := hardwareCandidate(codec, family, gpuType, "")
+		if selected != nil {
+			candidates = pinGPU(candidates, *selected, allGPUs)
+		}
+		return candidates
+	default:
+		gpuType, device := "intel_integrated", ""
+		if gpu != nil {
+			device = gpu.RenderNode
+		}
+		if gpu != nil && gpu.Vendor == "amd" {
+			gpuType = "amd_discrete"
+			if gpu.IsIntegrated {
+				gpuType = "amd_integrated"
 			}
 		}
+		return hardwareCandidate(codec, "vaapi", gpuType, device)
 	}
+}
 
-	log.Warn("No suitable GPU configuration found, defaulting to CPU")
-	return "libx264", "libx264", "cpu"
+// pinGPU - makes the candidates encode on the GPU picked by --gpu-index (or the prompt) instead of the driver default:
+// nvenc by its index among the nvidia GPUs (-gpu, CUDA order follows the PCI order unless CUDA_DEVICE_ORDER says
+// otherwise), qsv by its render node, amf by the d3d11 adapter index. vaapi already carries the render node.
+// Candidates that cannot be pinned are kept with a warning, the flag does not go silently unused
+func pinGPU(candidates []encoderCandidate, gpu entities.GPU, allGPUs []entities.GPU) []encoderCandidate {
+	vendorIndex, adapterIndex := 0, 0
+	for i := range allGPUs {
+		if allGPUs[i] == gpu {
+			adapterIndex = i
+			break
+		}
+		if allGPUs[i].Vendor == gpu.Vendor {
+			vendorIndex++
+		}
+	}
+
+	pinned := make([]encoderCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		switch {
+		case c.Name == "nvenc" && gpu.Vendor == "nvidia":
+			c.Adapter = strconv.Itoa(vendorIndex)
+		case c.Name == "qsv" && gpu.Vendor == "intel" && gpu.RenderNode != "":
+			c.Device = gpu.RenderNode
+		case c.Name == "amf" && gpu.Vendor == "amd" && runtime.GOOS == "windows":
+			c.Adapter = strconv.Itoa(adapterIndex)
+		case c.Name == "vaapi" && gpu.RenderNode != "":
+			c.Device = gpu.RenderNode
+		default:
+			log.Warn(fmt.Sprintf("%s cannot be pinned to %s, it encodes on the GPU its driver picks", c.Codec, gpu.Name))
+		}
+		pinned = append(pinned, c)
+	}
+	return pinned
 }
 
-func resolveEncoderForGPU(g entities.GPU) (string, string, string) {
+// resolveEncoderForGPU - encoders of the codec the GPU vendor usually provides, best first
+func resolveEncoderForGPU(g entities.GPU, codec string) []encoderCandidate {
 	switch g.Vendor {
 	case "nvidia":
-		if checkEncoderSupport("hevc_nvenc") {
-			return "hevc_nvenc", "nvenc_hevc", "nvidia"
-		}
-		return "h264_nvenc", "nvenc", "nvidia"
+		return hardwareCandidate(codec, "nvenc", "nvidia", "")
 
 	case "amd":
+		gpuType := "amd_discrete"
+		if g.IsIntegrated {
+			gpuType = "amd_integrated"
+		}
 		if runtime.GOOS == "windows" {
-			return "h264_amf", "amf", "amd_discrete"
+			return hardwareCandidate(codec, "amf", gpuType, "")
 		}
-		return "h264_vaapi", "vaapi", "amd_discrete"
+		return hardwareCandidate(codec, "vaapi", gpuType, g.RenderNode)
 
 	case "intel":
-		if checkEncoderSupport("h264_qsv") {
-			return "h264_qsv", "qsv", "intel_integrated"
-		}
-		return "h264_vaapi", "vaapi", "intel_integrated"
+		return append(hardwareCandidate(codec, "qsv", "intel_integrated", ""),
+			hardwareCandidate(codec, "vaapi", "intel_integrated", g.RenderNode)...)
 
 	default:
-		return "libx264", "libx264", "cpu"
+		return nil
+	}
+}
+
+// videoOutput - encoder picked for a video file, its ffmpeg output arguments and the size of the encoded frames
+type videoOutput struct {
+	encoder       encoderCandidate
+	args          ffmpeg.KwArgs
+	width, height int
+}
+
+// newVideoOutput - picks and probes the encoder for width x height rgb24 input, logs the choice and the scaling
+func newVideoOutput(filename string, width, height int, encoderOpts entities.EncoderOptions, gpus gpuSelection, quality qualitySettings) videoOutput {
+	encoder := getGPUEncoder(width, height, encoderOpts, gpus, quality)
+	log.Info(fmt.Sprintf("Selected encoder: %s (%s) for %s", encoder.Name, encoder.Codec, encoder.GPUType))
+	if _, ok := tuneArgs(encoder, quality.Tune); quality.Tune != "" && !ok {
+		log.Warn(fmt.Sprintf("%s has no equivalent of --tune=%s, encoding %s without it", encoder.Codec, quality.Tune, filename))
+	}
+	if encoderOpts.MaxSize != "" {
+		log.Warn("--max-size only applies to .gif, .apng and .webp outputs, ignoring it")
+	}
+
+	// ye. we need to keep in mind that anything other than x264 (CPU) encoders have limits, probe found them out
+	size := outputDimensions(encoder, width, height, quality)
+	switch {
+	case size.padded():
+		log.Info(fmt.Sprintf("Output resolution of %s: %dx%d, frames scaled to %dx%d and padded", filename, size.width, size.height, size.picture.X, size.picture.Y))
+	case size.scaled:
+		log.Info(fmt.Sprintf("Output resolution of %s (will be scaled by ffmpeg): %dx%d", filename, size.width, size.height))
+	case quality.Upscale > 1:
+		log.Info(fmt.Sprintf("Output resolution of %s (nearest upscale x%d): %dx%d", filename, quality.Upscale, size.width, size.height))
+	}
+
+	outputArgs := getEncoderArgs(encoder, width, height, quality)
+	if ext := strings.ToLower(filepath.Ext(filename)); encoder.Format == "hevc" && (ext == ".mp4" || ext == ".mov") {
+		outputArgs["tag:v"] = "hvc1" // apple players refuse the default hev1 tag
+	}
+	return videoOutput{encoder: encoder, args: outputArgs, width: size.width, height: size.height}
+}
+
+// outputSize - encoded video and the frames inside it
+type outputSize struct {
+	width, height int
+	upscaled      image.Point // frames after --upscale, what ffmpeg scales from
+	picture       image.Point // frames scaled to fit, centred in width x height and padded with the background
+	scaled        bool        // ffmpeg scales (and pads) the upscaled frames
+}
+
+// padded - the frames do not fill the video, the output size has another aspect than the canvas
+func (s outputSize) padded() bool {
+	return s.picture.X != s.width || s.picture.Y != s.height
+}
+
+// neighbor - the picture is a whole multiple of the frames, nearest neighbour keeps every block sharp
+func (s outputSize) neighbor() bool {
+	return s.picture.X > s.upscaled.X && s.picture.X%s.upscaled.X == 0 && s.picture.Y%s.upscaled.Y == 0 &&
+		s.picture.X/s.upscaled.X == s.picture.Y/s.upscaled.Y
+}
+
+// outputDimensions - size of the encoded video: the size of the output (input upscaled by --upscale without one), cut
+// down to the encoder limits. The frames are fit into it keeping their aspect
+func outputDimensions(enc encoderCandidate, width, height int, quality qualitySettings) outputSize {
+	up := image.Pt(width, height)
+	if quality.Upscale > 1 {
+		up = up.Mul(quality.Upscale)
 	}
+	size := outputSize{width: up.X, height: up.Y, upscaled: up}
+	targeted := quality.Width > 0 && quality.Height > 0
+	if targeted {
+		size.width, size.height = quality.Width, quality.Height
+	}
+	size.width, size.height = calculateScaledDimensions(size.width, size.height, enc.MaxWidth, enc.MaxHeight)
+	size.picture = image.Pt(size.width, size.height)
+	if targeted {
+		size.picture.X, size.picture.Y = fitDimensions(up.X, up.Y, size.width, size.height)
+	}
+	size.scaled = size.picture != up || size.padded()
+	return size
 }
 
-func checkEncoderSupport(codec string) bool {
-	cmd := exec.Command("ffmpeg", "-hide_banner", "-encoders")
-	output, err := cmd.Output()
-	if err != nil {
-		return false
+// scaleFilter - the upscaled frames scaled to the picture and padded to the output size, empty - no scaling
+func (s outputSize) scaleFilter() string {
+	if !s.scaled {
+		return ""
+	}
+	flags := "lanczos"
+	if s.neighbor() {
+		flags = "neighbor"
+	}
+	filter := fmt.Sprintf("scale=%d:%d:flags=%s", s.picture.X, s.picture.Y, flags)
+	if s.padded() {
+		// the letterbox colour of the canvas
+		filter += fmt.Sprintf(",pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=0x232323", s.width, s.height)
 	}
-	return strings.Contains(string(output), codec)
+	return filter
 }
 
-func getEncoderArgs(encoder, encoderName, gpuType string, width, height int, useScaling bool) ffmpeg.KwArgs {
+func getEncoderArgs(enc encoderCandidate, width, height int, quality qualitySettings) ffmpeg.KwArgs {
 	baseArgs := ffmpeg.KwArgs{}
-	targetWidth, targetHeight := width, height
-	if useScaling {
-		targetWidth, targetHeight = calculateScaledDimensions(width, height, gpuType)
+	encoder := enc.Codec
+	size := outputDimensions(enc, width, height, quality)
+	// whole multiples keep the blocks sharp, other sizes are filtered
+	scale := size.scaleFilter()
+
+	// integer nearest upscale keeps every texture pixel a sharp square, done before any hardware upload
+	upscale := ""
+	if quality.Upscale > 1 {
+		upscale = fmt.Sprintf("scale=iw*%d:ih*%d:flags=neighbor", quality.Upscale, quality.Upscale)
+	}
+
+	// chroma subsampling bleeds single block colours, pixel perfect mode keeps full chroma
+	pixFmt := "yuv420p"
+	if quality.PixelPerfect {
+		pixFmt = "yuv444p"
+	}
+	if enc.PixFmt != "" {
+		pixFmt = enc.PixFmt
 	}
 
-	switch encoderName {
-	case "nvenc", "nvenc_hevc":
+	// h264 profile names differ from hevc/av1 ones
+	profile := "main"
+	if enc.Format == "h264" {
+		profile = "high"
+	}
+
+	switch enc.Name {
+	case "nvenc":
 		baseArgs["c:v"] = encoder
-		baseArgs["preset"] = "p4"
-		baseArgs["cq"] = "23"
-		baseArgs["rc"] = "vbr"
 		baseArgs["color_range"] = "pc"
 		baseArgs["colorspace"] = "bt709"
 		baseArgs["color_primaries"] = "bt709"
 		baseArgs["color_trc"] = "bt709"
-		if useScaling {
-			baseArgs["vf"] = fmt.Sprintf("format=nv12,hwupload_cuda,scale_cuda=w=%d:h=%d:interp_algo=nearest", targetWidth, targetHeight)
+		upload := "hwupload_cuda"
+		if enc.Adapter != "" {
+			baseArgs["gpu"] = enc.Adapter
+			// the frames have to land on the GPU that encodes them
+			upload = "hwupload_cuda=device=" + enc.Adapter
+		}
+		switch {
+		case size.padded():
+			// scale_cuda cannot pad, the frames are fit on the CPU before nvenc uploads them
+			baseArgs["pix_fmt"] = pixFmt
+			baseArgs["vf"] = joinFilters(upscale, scale)
+		case size.scaled:
+			uploadFmt := "nv12"
+			if quality.PixelPerfect || enc.PixFmt != "" {
+				uploadFmt = pixFmt
+			}
+			interp := "lanczos"
+			if size.neighbor() {
+				interp = "nearest"
+			}
+			baseArgs["vf"] = joinFilters(upscale, fmt.Sprintf("format=%s,%s,scale_cuda=w=%d:h=%d:interp_algo=%s", uploadFmt, upload, size.width, size.height, interp))
+		default:
+			baseArgs["pix_fmt"] = pixFmt
+			if upscale != "" {
+				baseArgs["vf"] = upscale
+			}
 		}
 	case "amf":
 		baseArgs["c:v"] = encoder
-		baseArgs["quality"] = "quality"
-		baseArgs["profile"] = "high"
-		if useScaling {
-			baseArgs["vf"] = fmt.Sprintf("scale=%d:%d:flags=lanczos,format=yuv420p", targetWidth, targetHeight)
+		if enc.Format != "av1" {
+			baseArgs["profile:v"] = profile
+		}
+		if enc.Adapter != "" {
+			// a pinned adapter gets the frames uploaded to its own d3d11 device, amf encodes on the device of its input
+			baseArgs["init_hw_device"] = "d3d11va=amf:" + enc.Adapter
+			baseArgs["filter_hw_device"] = "amf"
+			baseArgs["vf"] = joinFilters(upscale, scale, "format=nv12,hwupload")
+		} else {
+			baseArgs["pix_fmt"] = pixFmt
+			if scale != "" {
+				baseArgs["vf"] = joinFilters(upscale, scale+",format="+pixFmt)
+			} else if upscale != "" {
+				baseArgs["vf"] = upscale
+			}
 		}
 	case "qsv":
 		baseArgs["c:v"] = encoder
-		baseArgs["preset"] = "quality"
-		baseArgs["profile"] = "high"
-		if useScaling {
-			baseArgs["vf"] = fmt.Sprintf("scale=%d:%d:flags=lanczos,format=yuv420p", targetWidth, targetHeight)
+		if enc.Device != "" {
+			baseArgs["qsv_device"] = enc.Device
+		}
+		baseArgs["pix_fmt"] = "nv12"
+		if enc.Format == "h264" || enc.Format == "hevc" {
+			baseArgs["profile:v"] = profile
+		}
+		if scale != "" {
+			baseArgs["vf"] = joinFilters(upscale, scale+",format=yuv420p")
+		} else if upscale != "" {
+			baseArgs["vf"] = upscale
 		}
 	case "vaapi":
 		baseArgs["c:v"] = encoder
-		if gpuType == "amd_integrated" || gpuType == "intel_integrated" {
-			baseArgs["vaapi_device"] = "/dev/dri/renderD128"
+		if enc.Device != "" {
+			baseArgs["vaapi_device"] = enc.Device
 		}
-		if useScaling {
-			baseArgs["vf"] = fmt.Sprintf("scale=%d:%d:flags=lanczos", targetWidth, targetHeight)
+		// frames have to be uploaded to the device, vaapi encoders do not take system memory input
+		baseArgs["vf"] = joinFilters(upscale, "format=nv12,hwupload")
+		if scale != "" {
+			baseArgs["vf"] = joinFilters(upscale, scale+",format=nv12,hwupload")
 		}
-	default: // libx264 and others
+	default: // libx264, libx264rgb, libx265, libsvtav1, libaom-av1, libvpx-vp9, prores_ks, ffv1
 		baseArgs["c:v"] = encoder
-		baseArgs["preset"] = "medium"
-		baseArgs["crf"] = "23"
+		switch enc.Codec {
+		case "libx264rgb":
+			baseArgs["pix_fmt"] = "rgb24"
+		case "ffv1":
+			baseArgs["pix_fmt"] = "gbrp"
+		case "prores_ks":
+			baseArgs["pix_fmt"] = "yuv422p10le"
+			if quality.PixelPerfect {
+				baseArgs["pix_fmt"] = "yuv444p10le"
+			}
+		default:
+			baseArgs["pix_fmt"] = pixFmt
+		}
+		if scale != "" {
+			baseArgs["vf"] = joinFilters(upscale, scale)
+		} else if upscale != "" {
+			baseArgs["vf"] = upscale
+		}
 	}
+	applyQuality(baseArgs, enc, quality)
 	return baseArgs
 }
+
+// joinFilters - comma separated filter chain of the non-empty parts
+func joinFilters(filters ...string) string {
+	var chain []string
+	for _, f := range filters {
+		if f != "" {
+			chain = append(chain, f)
+		}
+	}
+	return strings.Join(chain, ",")
+}
@@ -0,0 +1,127 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"image"
+	"testing"
+)
+
+func TestOutputDimensions(t *testing.T) {
+	cpu := encoderCandidate{Codec: "libx264", Name: "libx264", GPUType: "cpu", Format: "h264"}
+	tests := []struct {
+		name          string
+		width, height int
+		quality       qualitySettings
+		want          outputSize
+		filter        string
+	}{
+		{
+			name: "canvas size", width: 1080, height: 1920,
+			want: outputSize{width: 1080, height: 1920, upscaled: image.Pt(1080, 1920), picture: image.Pt(1080, 1920)},
+		},
+		{
+			name: "whole multiple", width: 1080, height: 1920, quality: qualitySettings{Width: 2160, Height: 3840},
+			want:   outputSize{width: 2160, height: 3840, upscaled: image.Pt(1080, 1920), picture: image.Pt(2160, 3840), scaled: true},
+			filter: "scale=2160:3840:flags=neighbor",
+		},
+		{
+			// portrait canvas in a landscape video, padded to exactly the requested size
+			name: "other aspect", width: 1080, height: 1920, quality: qualitySettings{Width: 3840, Height: 2160},
+			want:   outputSize{width: 3840, height: 2160, upscaled: image.Pt(1080, 1920), picture: image.Pt(1214, 2160), scaled: true},
+			filter: "scale=1214:2160:flags=lanczos,pad=3840:2160:(ow-iw)/2:(oh-ih)/2:color=0x232323",
+		},
+		{
+			name: "not a whole multiple", width: 1280, height: 720, quality: qualitySettings{Width: 1920, Height: 1080},
+			want:   outputSize{width: 1920, height: 1080, upscaled: image.Pt(1280, 720), picture: image.Pt(1920, 1080), scaled: true},
+			filter: "scale=1920:1080:flags=lanczos",
+		},
+		{
+			name: "upscaled then downscaled", width: 640, height: 360, quality: qualitySettings{Upscale: 4, Width: 1920, Height: 1080},
+			want:   outputSize{width: 1920, height: 1080, upscaled: image.Pt(2560, 1440), picture: image.Pt(1920, 1080), scaled: true},
+			filter: "scale=1920:1080:flags=lanczos",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := outputDimensions(cpu, tt.width, tt.height, tt.quality)
+			if got != tt.want {
+				t.Errorf("outputDimensions = %+v, want %+v", got, tt.want)
+			}
+			if filter := got.scaleFilter(); filter != tt.filter {
+				t.Errorf("scaleFilter = %q, want %q", filter, tt.filter)
+			}
+		})
+	}
+}
+
+func TestOutputDimensionsEncoderLimit(t *testing.T) {
+	limited := encoderCandidate{Codec: "h264_nvenc", Name: "nvenc", GPUType: "nvidia", Format: "h264", MaxWidth: 4096, MaxHeight: 4096}
+	got := outputDimensions(limited, 1080, 1920, qualitySettings{Width: 4320, Height: 7680})
+	if got.width > 4096 || got.height > 4096 || got.padded() {
+		t.Errorf("outputDimensions = %+v, want the frame within 4096x4096 and not padded", got)
+	}
+}
+
+func TestContainerCodec(t *testing.T) {
+	tests := []struct{ file, codec, want string }{
+		{"a.mp4", "", "h264"},
+		{"a.webm", "", "vp9"},
+		{"a.webm", "av1", "av1"},
+		{"a.mkv", "ffv1", "ffv1"},
+		{"a.gif", "", ""},
+	}
+	for _, tt := range tests {
+		if got := ContainerCodec(tt.file, tt.codec); got != tt.want {
+			t.Errorf("ContainerCodec(%q, %q) = %q, want %q", tt.file, tt.codec, got, tt.want)
+		}
+	}
+	// an explicit codec the container cannot hold is rejected, whether there is one output or several
+	if err := ValidateOutput("a.webm", "h264", ""); err == nil {
+		t.Error("ValidateOutput accepted h264 in .webm")
+	}
+}
+
+func TestParseOutputOddSize(t *testing.T) {
+	if _, err := ParseOutput("a.mp4:1921x1080"); err == nil {
+		t.Error("odd output width was accepted")
+	}
+	target, err := ParseOutput("a.mp4:1920x1080")
+	if err != nil || target.File != "a.mp4" || target.Width != 1920 || target.Height != 1080 {
+		t.Errorf("ParseOutput = %+v, %v", target, err)
+	}
+}
+
+func TestGPUByName(t *testing.T) {
+	all := []entities.GPU{{Name: "Intel UHD Graphics 770"}, {Name: "NVIDIA GeForce RTX 4090"}, {Name: "NVIDIA GeForce RTX 4090 D"}}
+	tests := []struct {
+		input string
+		want  int // index into all, -1 - none
+	}{
+		{"nvidia geforce rtx 4090", 1},
+		{"uhd", 0},
+		{"4090 d", 2},
+		{"nvidia", -1}, // ambiguous
+		{"radeon", -1},
+	}
+	for _, tt := range tests {
+		got := gpuByName(all, tt.input)
+		if (tt.want < 0 && got != nil) || (tt.want >= 0 && got != &all[tt.want]) {
+			t.Errorf("gpuByName(%q) = %v, want index %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEncoderCandidatesExplicit(t *testing.T) {
+	tests := []struct{ encoder, codec, format string }{
+		{"libx265", "h264", "hevc"},
+		{"h264_nvenc", "h264", "h264"},
+		// not in videoCodecs: the codec it writes is unknown, the container default would fail the check
+		{"mpeg4", "h264", ""},
+	}
+	for _, tt := range tests {
+		candidates := encoderCandidates(1920, 1080, tt.codec, entities.EncoderOptions{Encoder: tt.encoder}, gpuSelection{}, false)
+		if len(candidates) == 0 || candidates[0].Codec != tt.encoder || candidates[0].Format != tt.format {
+			t.Errorf("--encoder=%s: first candidate %+v, want format %q", tt.encoder, candidates, tt.format)
+		}
+	}
+}
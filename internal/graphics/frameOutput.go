@@ -0,0 +1,80 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/vovamod/utils/log"
+)
+
+// frameSkipper - sink keeping per-frame timing (GIF delays, AVI null frames, timestamped ffmpeg input). An unchanged
+// frame is not sent again, the previous one is shown a frame longer
+type frameSkipper interface {
+	SkipFrame() error
+}
+
+// frameOutput - the sink of one run plus what was saved by skipping unchanged frames
+type frameOutput struct {
+	sink    frameSink
+	skipper frameSkipper // nil - the sink needs every frame
+	width   int
+	height  int // frame height, footer included
+
+	written, skipped int
+	dirtyArea        int64 // changed pixels of the written timelapse frames
+	timelapseFrames  int
+}
+
+// newFrameOutput - skip: unchanged frames may be left out (paced renders), otherwise the sink gets every frame even if it
+// could skip it, hold and title frames of a plain render stay real frames
+func newFrameOutput(sink frameSink, width, height int, skip bool) *frameOutput {
+	var skipper frameSkipper
+	if skip {
+		skipper, _ = sink.(frameSkipper)
+	}
+	return &frameOutput{sink: sink, skipper: skipper, width: width, height: height}
+}
+
+// write - hands the frame to the sink, or skips it when nothing changed since the previous one and the sink can
+func (o *frameOutput) write(pix []uint8, changed bool) error {
+	if !changed && o.skipper != nil && o.written > 0 {
+		if err := o.skipper.SkipFrame(); err != nil {
+			return err
+		}
+		o.skipped++
+		return nil
+	}
+	if err := o.sink.WriteFrame(pix); err != nil {
+		return err
+	}
+	o.written++
+	return nil
+}
+
+// writeDirty - timelapse frame with the region changed since the last written one (empty - nothing changed)
+func (o *frameOutput) writeDirty(pix []uint8, dirty image.Rectangle) error {
+	o.timelapseFrames++
+	o.dirtyArea += int64(dirty.Dx() * dirty.Dy())
+	log.Debugf("Dirty region: %v", dirty)
+	return o.write(pix, !dirty.Empty())
+}
+
+// frames - frames of the video, skipped ones included (they are still shown, only not sent)
+func (o *frameOutput) frames() int {
+	return o.written + o.skipped
+}
+
+// logStats - how much of the frame data did not have to go through the sink
+func (o *frameOutput) logStats() {
+	frameSize := int64(o.width * o.height * 3)
+	if o.timelapseFrames > 0 {
+		log.Info(fmt.Sprintf("Changed area per frame: %.1f%% of the frame on average",
+			float64(o.dirtyArea)*100/float64(int64(o.timelapseFrames)*int64(o.width*o.height))))
+	}
+	if o.skipped == 0 {
+		return
+	}
+	saved := int64(o.skipped) * frameSize
+	log.Info(fmt.Sprintf("Skipped %d unchanged frames of %d, %.1f MB (%.1f%%) not sent to the encoder",
+		o.skipped, o.frames(), float64(saved)/(1<<20), float64(o.skipped)*100/float64(o.frames())))
+}
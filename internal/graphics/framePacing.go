@@ -0,0 +1,74 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"time"
+)
+
+// maxPacedFrames - upper bound of frames --pace may cut the records into (over 4.5 hours of video at 60 fps), a
+// mistyped pace (--pace=1ms over a month of records) would otherwise allocate and encode billions of empty frames
+const maxPacedFrames = 1_000_000
+
+// frameSpan - records [start, end) of one video frame and the real time it covers
+type frameSpan struct {
+	start, end int
+	from, to   time.Time
+}
+
+// frameSpans - splits the records into video frames: every --iterations records, or with --pace a fixed span of real
+// time per frame. Paced frames without records are empty, the canvas just stays as it is. Paced frames start at
+// paceOrigin (zero - the first record) and run for at least minFrames frames
+func (r frameRender) frameSpans(dest []entities.VisualData) []frameSpan {
+	var spans []frameSpan
+	if r.pace <= 0 {
+		for i := 0; i < len(dest); i += r.iterations {
+			end := min(i+r.iterations, len(dest))
+			spans = append(spans, frameSpan{start: i, end: end, from: dest[i].Time, to: dest[end-1].Time})
+		}
+		return spans
+	}
+	if len(dest) == 0 {
+		return nil
+	}
+
+	// reversed records run backwards in time, the pace follows their direction
+	origin := dest[0].Time
+	if !r.paceOrigin.IsZero() {
+		origin = r.paceOrigin
+	}
+	direction := time.Duration(1)
+	if dest[len(dest)-1].Time.Before(origin) {
+		direction = -1
+	}
+	start := 0
+	for k := 1; start < len(dest) || k <= r.minFrames; k++ {
+		to := origin.Add(direction * time.Duration(k) * r.pace)
+		end := start
+		for end < len(dest) && direction*dest[end].Time.Sub(to) < 0 {
+			end++
+		}
+		spans = append(spans, frameSpan{start: start, end: end, from: to.Add(-direction * r.pace), to: to})
+		start = end
+	}
+	return spans
+}
+
+// checkPace - error when the pace cuts the records into more than maxPacedFrames frames
+func (r frameRender) checkPace(dest []entities.VisualData) error {
+	if r.pace <= 0 || len(dest) == 0 {
+		return nil
+	}
+	origin := dest[0].Time
+	if !r.paceOrigin.IsZero() {
+		origin = r.paceOrigin
+	}
+	span := dest[len(dest)-1].Time.Sub(origin)
+	if span < 0 {
+		span = -span
+	}
+	if frames := span/r.pace + 1; frames > maxPacedFrames {
+		return fmt.Errorf("--pace=%v cuts %v of records into %d frames, more than %d: use a longer pace", r.pace, span.Round(time.Second), frames, maxPacedFrames)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"testing"
+	"time"
+)
+
+func TestFrameSpansPaced(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	dest := []entities.VisualData{{Time: start}, {Time: start.Add(30 * time.Second)}, {Time: start.Add(3 * time.Minute)}}
+	spans := frameRender{pace: time.Minute}.frameSpans(dest)
+	want := [][2]int{{0, 2}, {2, 2}, {2, 2}, {2, 3}}
+	if len(spans) != len(want) {
+		t.Fatalf("%d spans, want %d", len(spans), len(want))
+	}
+	for i, w := range want {
+		if spans[i].start != w[0] || spans[i].end != w[1] {
+			t.Errorf("span %d = [%d, %d), want [%d, %d)", i, spans[i].start, spans[i].end, w[0], w[1])
+		}
+	}
+}
+
+func TestCheckPace(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	month := []entities.VisualData{{Time: start}, {Time: start.Add(30 * 24 * time.Hour)}}
+	tests := []struct {
+		name string
+		pace time.Duration
+		dest []entities.VisualData
+		ok   bool
+	}{
+		{"not paced", 0, month, true},
+		{"five minutes over a month", 5 * time.Minute, month, true},
+		{"a millisecond over a month", time.Millisecond, month, false},
+		{"reversed records", time.Millisecond, []entities.VisualData{month[1], month[0]}, false},
+		{"no records", time.Millisecond, nil, true},
+	}
+	for _, tt := range tests {
+		if err := (frameRender{pace: tt.pace}).checkPace(tt.dest); (err == nil) != tt.ok {
+			t.Errorf("%s: checkPace = %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+	"github.com/vovamod/utils/log"
+)
+
+// frameSink - destination of rendered RGB24 frames: the ffmpeg pipe or one of the pure Go encoders
+type frameSink interface {
+	WriteFrame(pix []uint8) error
+	Close() error
+}
+
+// ffmpegSink - raw RGB24 frames piped into an ffmpeg process
+type ffmpegSink struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+// newFFmpegSink - starts ffmpeg reading width x height rgb24 frames at framerate/step fps from stdin, the soundtrack
+// (nil - none) is muxed in the same run
+func newFFmpegSink(filename string, width, height, framerate, step int, outputArgs ffmpeg.KwArgs, audio *soundtrack, debug bool) *ffmpegSink {
+	rate := fmt.Sprintf("%d", framerate)
+	if step > 1 {
+		rate = fmt.Sprintf("%d/%d", framerate, step)
+	}
+	return startFFmpeg(filename, ffmpeg.KwArgs{
+		"f":                 "rawvideo",
+		"pix_fmt":           "rgb24",
+		"s":                 fmt.Sprintf("%dx%d", width, height),
+		"r":                 rate,
+		"thread_queue_size": "2", // Buffer for high-speed input
+	}, outputArgs, audio, debug)
+}
+
+// startFFmpeg - ffmpeg reading the video from stdin in the given input format
+func startFFmpeg(filename string, input, outputArgs ffmpeg.KwArgs, audio *soundtrack, debug bool) *ffmpegSink {
+	pr, pw := io.Pipe()
+	s := &ffmpegSink{pw: pw, done: make(chan struct{})}
+
+	go func() {
+		streams := []*ffmpeg.Stream{ffmpeg.Input("pipe:0", input)}
+		if audio != nil {
+			streams = append(streams, audio.stream())
+			audio.codecArgs(filename, outputArgs)
+		}
+		stream := ffmpeg.Output(streams, filename, outputArgs).
+			OverWriteOutput().
+			WithInput(pr)
+		if debug {
+			stream = stream.Silent(false).ErrorToStdOut()
+		}
+		s.err = stream.Run()
+		// ffmpeg is gone, unblock a pending write instead of hanging on a pipe nobody reads
+		pr.CloseWithError(io.ErrClosedPipe)
+		close(s.done)
+	}()
+	return s
+}
+
+func (s *ffmpegSink) WriteFrame(pix []uint8) error {
+	if _, err := s.pw.Write(pix); err != nil {
+		<-s.done
+		if s.err != nil {
+			return fmt.Errorf("ffmpeg crashed: %v", s.err)
+		}
+		return fmt.Errorf("ffmpeg pipe broken: %w", err)
+	}
+	return nil
+}
+
+func (s *ffmpegSink) Close() error {
+	if err := s.pw.Close(); err != nil {
+		return fmt.Errorf("could not close ffmpeg pipe: %w", err)
+	}
+	<-s.done
+	if s.err != nil {
+		return fmt.Errorf("ffmpeg failed during finalization: %w", s.err)
+	}
+	return nil
+}
+
+// resumableSink - sink able to make every frame written so far durable before a checkpoint is saved. Returns the
+// number of finished video parts
+type resumableSink interface {
+	frameSink
+	Flush() (int, error)
+}
+
+// segmentSink - video written as numbered parts, a new one after every checkpoint, joined without re-encoding on Close.
+// Finished parts are never touched again so a resumed render only appends new ones
+type segmentSink struct {
+	filename string
+	parts    int
+	current  *ffmpegSink
+	open     func(part string) *ffmpegSink
+	tag      string
+	audio    *soundtrack // muxed while joining, parts are silent
+}
+
+func newSegmentSink(filename string, parts int, width, height, framerate int, outputArgs ffmpeg.KwArgs, audio *soundtrack, debug bool) *segmentSink {
+	tag, _ := outputArgs["tag:v"].(string)
+	return &segmentSink{
+		filename: filename,
+		parts:    parts,
+		tag:      tag,
+		audio:    audio,
+		open: func(part string) *ffmpegSink {
+			return newFFmpegSink(part, width, height, framerate, 1, outputArgs, nil, debug)
+		},
+	}
+}
+
+// segmentName - out.mp4 -> out.part003.mp4
+func segmentName(filename string, part int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s.part%03d%s", strings.TrimSuffix(filename, ext), part, ext)
+}
+
+func (s *segmentSink) WriteFrame(pix []uint8) error {
+	if s.current == nil {
+		s.current = s.open(segmentName(s.filename, s.parts))
+	}
+	return s.current.WriteFrame(pix)
+}
+
+func (s *segmentSink) Flush() (int, error) {
+	if s.current == nil {
+		return s.parts, nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	if err != nil {
+		return s.parts, err
+	}
+	s.parts++
+	return s.parts, nil
+}
+
+func (s *segmentSink) Close() error {
+	if _, err := s.Flush(); err != nil {
+		return err
+	}
+
+	// concat demuxer list, absolute paths since they are resolved relative to the list file
+	var list strings.Builder
+	for i := 0; i < s.parts; i++ {
+		part, err := filepath.Abs(segmentName(s.filename, i))
+		if err != nil {
+			return err
+		}
+		list.WriteString(fmt.Sprintf("file '%s'\n", strings.ReplaceAll(part, "'", `'\''`)))
+	}
+	listFile := s.filename + ".parts.txt"
+	if err := os.WriteFile(listFile, []byte(list.String()), 0o644); err != nil {
+		return fmt.Errorf("could not write segment list: %w", err)
+	}
+
+	args := ffmpeg.KwArgs{"c:v": "copy"}
+	if s.tag != "" {
+		args["tag:v"] = s.tag
+	}
+	streams := []*ffmpeg.Stream{ffmpeg.Input(listFile, ffmpeg.KwArgs{"f": "concat", "safe": "0"})}
+	if s.audio != nil {
+		streams = append(streams, s.audio.stream())
+		s.audio.codecArgs(s.filename, args)
+	}
+	err := ffmpeg.Output(streams, s.filename, args).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		return fmt.Errorf("could not join %d video parts: %w", s.parts, err)
+	}
+
+	for i := 0; i < s.parts; i++ {
+		if err = os.Remove(segmentName(s.filename, i)); err != nil {
+			log.Warn("Could not remove video part: " + err.Error())
+		}
+	}
+	if err = os.Remove(listFile); err != nil {
+		log.Warn("Could not remove segment list: " + err.Error())
+	}
+	return nil
+}
+
+// pngSequenceSink - numbered png files (frame_000001.png, ...) for editing in external tools, no ffmpeg involved
+type pngSequenceSink struct {
+	dir     string
+	next    int
+	img     *image.NRGBA
+	encoder png.Encoder
+}
+
+func newPNGSequenceSink(dir string, width, height, firstFrame int) (*pngSequenceSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create frames directory: %w", err)
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return &pngSequenceSink{
+		dir:     dir,
+		next:    firstFrame + 1,
+		img:     img,
+		encoder: png.Encoder{CompressionLevel: png.BestSpeed},
+	}, nil
+}
+
+func (s *pngSequenceSink) WriteFrame(pix []uint8) error {
+	dst := s.img.Pix
+	for i, j := 0, 0; i+2 < len(pix); i, j = i+3, j+4 {
+		dst[j], dst[j+1], dst[j+2] = pix[i], pix[i+1], pix[i+2]
+	}
+
+	f, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("frame_%06d.png", s.next)))
+	if err != nil {
+		return fmt.Errorf("could not create frame: %w", err)
+	}
+	defer func(f *os.File) {
+		err = f.Close()
+		if err != nil {
+			log.Errorf("Error while closing file: %v", err)
+		}
+	}(f)
+
+	if err = s.encoder.Encode(f, s.img); err != nil {
+		return fmt.Errorf("png encoding failed: %w", err)
+	}
+	s.next++
+	return nil
+}
+
+// Flush - every frame is its own file already
+func (s *pngSequenceSink) Flush() (int, error) {
+	return 0, nil
+}
+
+func (s *pngSequenceSink) Close() error {
+	return nil
+}
@@ -0,0 +1,220 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/vovamod/utils/log"
+)
+
+// aspectPresets - frame size of every --aspect preset, the footer is part of the frame
+var aspectPresets = map[string]image.Point{
+	"9:16": {1080, 1920},
+	"16:9": {1920, 1080},
+	"1:1":  {1080, 1080},
+}
+
+// maxCropGrid - cells of the activity table searched by crop framing, larger record areas are counted in coarser cells
+const maxCropGrid = 1 << 22
+
+// AspectSize - frame size of the --aspect preset
+func AspectSize(aspect string) (int, int, error) {
+	size, ok := aspectPresets[aspect]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown aspect %q, use 9:16, 16:9 or 1:1", aspect)
+	}
+	return size.X, size.Y, nil
+}
+
+// frameLayout - where the records land on the canvas of a preset. Records are moved so that shift is cell 0,0 and
+// drawn at cell pixels per block, world is the part of the canvas covered by them (the rest is letterbox). Worlds too
+// large for the frame are downsampled, sample x sample blocks share one cell
+type frameLayout struct {
+	cell   int
+	sample int // blocks per cell side, 0 and 1 - every block has its own cell
+	shift  image.Point
+	world  image.Rectangle
+}
+
+// recordBounds - cells touched by the records
+func recordBounds(dest []entities.VisualData) image.Rectangle {
+	var bounds image.Rectangle
+	for i, block := range dest {
+		cell := image.Rect(int(block.X), int(block.Y), int(block.X)+1, int(block.Y)+1)
+		if i == 0 {
+			bounds = cell
+			continue
+		}
+		bounds = bounds.Union(cell)
+	}
+	return bounds
+}
+
+// fitLayout - the largest whole number of pixels per block showing every record on the width x height frame, centred
+// to the nearest cell. The footer (the bottom footer rows of the frame) goes into the letterbox band under the records
+// when the band is tall enough, otherwise the records are fit into the frame above it. Records wider or taller than the
+// frame are downsampled to a pixel per sample x sample blocks. Returns the layout and the canvas height above the footer
+func fitLayout(bounds image.Rectangle, width, height, footer int) (frameLayout, int) {
+	canvas := height - footer
+	// groups are aligned to multiples of sample, a group cut by the bounds can add a cell
+	sample := max((bounds.Dx()+width-1)/width, (bounds.Dy()+canvas-1)/canvas, 1)
+	sampled := sampleBounds(bounds, sample)
+	for sampled.Dx() > width || sampled.Dy() > canvas {
+		sample++
+		sampled = sampleBounds(bounds, sample)
+	}
+
+	layout := centreLayout(sampled, width, height)
+	if height-layout.world.Max.Y < footer {
+		layout = centreLayout(sampled, width, canvas)
+	}
+	layout.sample = sample
+	return layout, canvas
+}
+
+// sampleBounds - cells of the bounds when sample x sample blocks share one
+func sampleBounds(bounds image.Rectangle, sample int) image.Rectangle {
+	return image.Rect(
+		floorDiv(bounds.Min.X, sample), floorDiv(bounds.Min.Y, sample),
+		floorDiv(bounds.Max.X-1, sample)+1, floorDiv(bounds.Max.Y-1, sample)+1,
+	)
+}
+
+// centreLayout - bounds at the largest whole number of pixels per cell fitting width x height, centred to the nearest
+// cell
+func centreLayout(bounds image.Rectangle, width, height int) frameLayout {
+	cell := max(min(width/bounds.Dx(), height/bounds.Dy()), 1)
+	offset := image.Pt(
+		int(math.Round(float64(width-bounds.Dx()*cell)/float64(2*cell))),
+		int(math.Round(float64(height-bounds.Dy()*cell)/float64(2*cell))),
+	)
+	return frameLayout{
+		cell:  cell,
+		shift: bounds.Min.Sub(offset),
+		world: image.Rectangle{Min: offset.Mul(cell), Max: offset.Add(bounds.Size()).Mul(cell)},
+	}
+}
+
+// floorDiv - division rounding towards negative infinity, records can have negative coordinates
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// cropLayout - the width x height window at textureSize pixels per block holding the most records. Sides where the
+// records are narrower than the window are centred instead
+func cropLayout(dest []entities.VisualData, bounds image.Rectangle, width, height, textureSize int) frameLayout {
+	window := image.Pt(max(width/textureSize, 1), max(height/textureSize, 1))
+	bw, bh := bounds.Dx(), bounds.Dy()
+
+	// summed-area table of the records per grid cell
+	g := max(int(math.Ceil(math.Sqrt(float64(bw)*float64(bh)/maxCropGrid))), 1)
+	gw, gh := (bw+g-1)/g, (bh+g-1)/g
+	sat := make([]int32, (gw+1)*(gh+1))
+	for _, block := range dest {
+		x, y := (int(block.X)-bounds.Min.X)/g, (int(block.Y)-bounds.Min.Y)/g
+		sat[(y+1)*(gw+1)+x+1]++
+	}
+	for y := 1; y <= gh; y++ {
+		for x := 1; x <= gw; x++ {
+			i := y*(gw+1) + x
+			sat[i] += sat[i-1] + sat[i-gw-1] - sat[i-gw-2]
+		}
+	}
+
+	ww, wh := min(max(window.X/g, 1), gw), min(max(window.Y/g, 1), gh)
+	best, bestCount := image.Point{}, int32(-1)
+	for y := 0; y+wh <= gh; y++ {
+		for x := 0; x+ww <= gw; x++ {
+			count := sat[(y+wh)*(gw+1)+x+ww] - sat[y*(gw+1)+x+ww] - sat[(y+wh)*(gw+1)+x] + sat[y*(gw+1)+x]
+			if count > bestCount {
+				best, bestCount = image.Pt(x, y), count
+			}
+		}
+	}
+
+	shift := bounds.Min.Add(best.Mul(g))
+	if bw <= window.X {
+		shift.X = bounds.Min.X - (window.X-bw)/2
+	} else {
+		shift.X = min(shift.X, bounds.Max.X-window.X)
+	}
+	if bh <= window.Y {
+		shift.Y = bounds.Min.Y - (window.Y-bh)/2
+	} else {
+		shift.Y = min(shift.Y, bounds.Max.Y-window.Y)
+	}
+	shown := bounds.Sub(shift).Intersect(image.Rectangle{Max: window})
+	return frameLayout{
+		cell:  textureSize,
+		shift: shift,
+		world: image.Rectangle{Min: shown.Min.Mul(textureSize), Max: shown.Max.Mul(textureSize)},
+	}
+}
+
+// apply - records moved into the layout, the ones outside of the canvas (crop) are left out. Downsampled blocks land in
+// the cell of their group, the latest record of the group is the one shown
+func (l frameLayout) apply(dest []entities.VisualData, width, height int) []entities.VisualData {
+	cols, rows := width/l.cell, height/l.cell
+	sample := max(l.sample, 1)
+	framed := make([]entities.VisualData, 0, len(dest))
+	for _, block := range dest {
+		block.X = int64(floorDiv(int(block.X), sample) - l.shift.X)
+		block.Y = int64(floorDiv(int(block.Y), sample) - l.shift.Y)
+		if block.X < 0 || block.Y < 0 || block.X >= int64(cols) || block.Y >= int64(rows) {
+			continue
+		}
+		framed = append(framed, block)
+	}
+	return framed
+}
+
+// letterbox - paints the canvas outside of the record area in the footer colour
+func (r frameRender) letterbox(pix []uint8) {
+	if r.world.Empty() {
+		return
+	}
+	for y := 0; y < r.height; y++ {
+		for x := 0; x < r.width; x++ {
+			if image.Pt(x, y).In(r.world) {
+				continue
+			}
+			i := (y*r.width + x) * 3
+			pix[i], pix[i+1], pix[i+2] = 35, 35, 35
+		}
+	}
+}
+
+// frameRecords - lays the records out on the width x height frame of the preset, footer rows of it are the footer.
+// Returns the framed records, the layout (blocks drawn at layout.cell px, see scaledTextures) and the canvas height
+// above the footer
+func frameRecords(dest []entities.VisualData, framing entities.FramingOptions, width, height, footer, textureSize int) ([]entities.VisualData, frameLayout, int, error) {
+	if len(dest) == 0 {
+		return dest, frameLayout{}, height, fmt.Errorf("--aspect needs records to frame, none were loaded")
+	}
+	bounds := recordBounds(dest)
+
+	var layout frameLayout
+	canvas := height - footer
+	if framing.Mode == "crop" {
+		layout = cropLayout(dest, bounds, width, canvas, textureSize)
+	} else {
+		layout, canvas = fitLayout(bounds, width, height, footer)
+	}
+	framed := layout.apply(dest, width, canvas)
+
+	switch {
+	case framing.Mode == "crop":
+		log.Info(fmt.Sprintf("Framing %s crop: blocks from %v, %d of %d records in view", framing.Aspect, layout.shift, len(framed), len(dest)))
+	case layout.sample > 1:
+		log.Warn(fmt.Sprintf("Framing %s fit: %dx%d blocks do not fit the frame, every pixel shows the latest of %dx%d blocks", framing.Aspect, bounds.Dx(), bounds.Dy(), layout.sample, layout.sample))
+	default:
+		log.Info(fmt.Sprintf("Framing %s fit: %dx%d blocks at %d px per block", framing.Aspect, bounds.Dx(), bounds.Dy(), layout.cell))
+	}
+	return framed, layout, canvas, nil
+}
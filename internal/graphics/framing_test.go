@@ -0,0 +1,92 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"image"
+	"testing"
+)
+
+func TestFitLayoutFooterInLetterbox(t *testing.T) {
+	// a square area on a portrait frame leaves tall bands, the footer takes the lower one
+	layout, canvas := fitLayout(image.Rect(0, 0, 100, 100), 1080, 1920, 192)
+	if layout.cell != 10 {
+		t.Errorf("cell %d, want 10 (the records keep the full frame height)", layout.cell)
+	}
+	if canvas != 1920-192 {
+		t.Errorf("canvas height %d, want %d", canvas, 1920-192)
+	}
+	if layout.world.Max.Y > canvas {
+		t.Errorf("world %v reaches into the footer", layout.world)
+	}
+}
+
+func TestFitLayoutFooterWithoutBand(t *testing.T) {
+	// the area fills the frame height, the records are fit above the footer instead
+	layout, canvas := fitLayout(image.Rect(0, 0, 54, 96), 1080, 1920, 192)
+	if layout.cell != 18 {
+		t.Errorf("cell %d, want 18", layout.cell)
+	}
+	if layout.world.Max.Y > canvas {
+		t.Errorf("world %v reaches into the footer", layout.world)
+	}
+}
+
+func TestFitLayoutDownsamplesLargeWorlds(t *testing.T) {
+	bounds := image.Rect(-1501, 0, 1500, 500)
+	layout, canvas := fitLayout(bounds, 1080, 1920, 192)
+	if layout.cell != 1 || layout.sample != 3 {
+		t.Fatalf("cell %d, sample %d, want 1 px per 3x3 blocks", layout.cell, layout.sample)
+	}
+
+	dest := []entities.VisualData{{X: -1501, Y: 0}, {X: 1499, Y: 499}, {X: 0, Y: 250}}
+	framed := layout.apply(dest, 1080, canvas)
+	if len(framed) != len(dest) {
+		t.Fatalf("%d of %d records on the canvas", len(framed), len(dest))
+	}
+	for _, block := range framed {
+		if !image.Pt(int(block.X), int(block.Y)).In(layout.world) {
+			t.Errorf("record at %d,%d outside of the world %v", block.X, block.Y, layout.world)
+		}
+	}
+}
+
+func TestFloorDiv(t *testing.T) {
+	for _, tt := range []struct{ a, b, want int }{{7, 3, 2}, {6, 3, 2}, {-1, 3, -1}, {-3, 3, -1}, {-4, 3, -2}, {0, 3, 0}} {
+		if got := floorDiv(tt.a, tt.b); got != tt.want {
+			t.Errorf("floorDiv(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestScaledTextures - blocks drawn at another size get scaled copies owned by the render, the shared cache is left
+// as loaded for whatever is rendered next in the process
+func TestScaledTextures(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	red := textureCacheRaw["red.png"]
+	frame := &entities.Texture{Pix: make([]byte, 16*16*4), Stride: 16 * 4, Rect: image.Rect(0, 0, 16, 16)}
+	red.Animation = &entities.TextureAnimation{Frames: []*entities.Texture{frame}, Sequence: []entities.AnimationFrame{{Index: 0, Time: 1}}, TotalTime: 1}
+
+	textures := scaledTextures(16, 4)
+	scaled := textures["red.png"]
+	if scaled == red || scaled.Rect.Dx() != 4 || len(scaled.RGB) != 4*4*3 || !bytes.Equal(scaled.RGB[:3], []byte{255, 0, 0}) {
+		t.Fatalf("scaled texture %v, want a 4px red copy", scaled.Rect)
+	}
+	if scaled.Animation == red.Animation || scaled.Animation.Frames[0] == frame || scaled.Animation.Frames[0].Rect.Dx() != 4 {
+		t.Error("animation frames were not copied and scaled")
+	}
+	if red.Rect.Dx() != 16 || frame.Rect.Dx() != 16 || len(red.RGB) != 16*16*3 {
+		t.Error("the shared texture cache was scaled in place")
+	}
+
+	state := &renderState{textures: textures}
+	if _, tex, _ := state.place(entities.VisualData{BlockTexture: "red.png"}); tex != scaled {
+		t.Error("the render state placed the unscaled texture")
+	}
+	if _, tex, _ := (&renderState{}).place(entities.VisualData{BlockTexture: "red.png"}); tex != red {
+		t.Error("a render without its own textures did not use the shared cache")
+	}
+	if names := state.textureNames(); names[scaled] != "red.png" {
+		t.Errorf("texture names %v, want the scaled copies", names)
+	}
+}
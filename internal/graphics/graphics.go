@@ -2,12 +2,16 @@ package graphics
 
 import (
 	"Timelapse-PixelBattle/pkg/entities"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/png"
-	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,11 +19,15 @@ import (
 	"golang.org/x/image/math/fixed"
 
 	"github.com/vovamod/utils/log"
-
-	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
-func EncodeGPU(dest []entities.VisualData, width, height, iterations, textureSize, framerate int, filename, playername string, renderTime, debug bool) error {
+func EncodeGPU(dest []entities.VisualData, width, height, iterations, textureSize, framerate int, outputs []entities.OutputTarget, playername string, renderTime, debug, freezeAnimations, reverse bool, encoderOpts entities.EncoderOptions, checkpoint entities.CheckpointOptions, cards entities.CardOptions, framing entities.FramingOptions) error {
+	var err error
+	if framing.Aspect != "" {
+		if width, height, err = AspectSize(framing.Aspect); err != nil {
+			return err
+		}
+	}
 	uiOffset := 0
 	if renderTime {
 		uiOffset = height / 10
@@ -27,177 +35,366 @@ func EncodeGPU(dest []entities.VisualData, width, height, iterations, textureSiz
 			uiOffset = 40
 		}
 	}
+	stats := newCardStats(dest)
+	var layout frameLayout
+	var textures map[string]*entities.Texture
+	if framing.Aspect != "" {
+		// the footer is part of the preset frame, the canvas of the records is the rest
+		if dest, layout, height, err = frameRecords(dest, framing, width, height, uiOffset, textureSize); err != nil {
+			return err
+		}
+		if layout.cell != textureSize {
+			textures = scaledTextures(textureSize, layout.cell)
+		}
+		textureSize = layout.cell
+	}
 	lenght := len(dest)
 	log.Info(fmt.Sprintf("Rendering graphics data for %d elements with GPU-optimized frames", lenght))
 	log.Info(fmt.Sprintf("Current configuration:\n  - Width: %v\n  - Height: %v\n  - Iterations: %v\n  - TextureSize: %v\n  - Framerate: %v",
 		width, height, iterations, textureSize, framerate))
 
-	encoder, encoderName, gpuType := getGPUEncoder(width, height)
-	log.Info(fmt.Sprintf("Selected encoder: %s (%s) for %s", encoderName, encoder, gpuType))
-
-	needsScaling := (width > 3840 || height > 2160) && encoderName != "libx264" // ye. we need to keep in mind that anything other than x264 (CPU) encoders have limits
-
-	if needsScaling {
-		scaledWidth, scaledHeight := calculateScaledDimensions(width, height, gpuType)
-		log.Info(fmt.Sprintf("Output resolution (will be scaled by ffmpeg): %dx%d", scaledWidth, scaledHeight))
-	}
-
-	inputHeight := height + uiOffset
-	outputArgs := getEncoderArgs(encoder, encoderName, gpuType, width, inputHeight, needsScaling)
-	// add pipe
-	pr, pw := io.Pipe()
-
-	stride := width * 3
-	pix := make([]uint8, inputHeight*stride)
-	for i := range pix {
-		pix[i] = 255
-	}
-
-	//bgTex, _ := getRawTexture("white_concrete.png")
-	//
-	//texWidth := bgTex.Rect.Dx()
-	//texHeight := bgTex.Rect.Dy()
-	//
-	//for y := 0; y < height; y += texHeight {
-	//	for x := 0; x < width; x += texWidth {
-	//
-	//		for row := 0; row < texHeight; row++ {
-	//			targetY := y + row
-	//			if targetY >= height { break }
-	//
-	//			canvasRowStart := targetY*stride + (x * 3)
-	//			texRowStart := row * bgTex.Stride
-	//
-	//			currentPaintWidth := texWidth
-	//			if x + texWidth > width {
-	//				currentPaintWidth = width - x
-	//			}
-	//
-	//			if canvasRowStart >= 0 && canvasRowStart+(currentPaintWidth*3) <= len(pix) {
-	//				for col := 0; col < currentPaintWidth; col++ {
-	//					cIdx := canvasRowStart + (col * 3)
-	//					tIdx := texRowStart + (col * 4)
-	//
-	//					pix[cIdx]   = bgTex.Pix[tIdx]   // R
-	//					pix[cIdx+1] = bgTex.Pix[tIdx+1] // G
-	//					pix[cIdx+2] = bgTex.Pix[tIdx+2] // B
-	//				}
-	//			}
-	//		}
-	//	}
-	//}
+	if len(outputs) == 0 {
+		return errors.New("no output to render to")
+	}
+	filename := outputs[0].File
+	quality, err := resolveQuality(encoderOpts)
+	if err != nil {
+		return err
+	}
+
+	render := frameRender{
+		width:            width,
+		height:           height,
+		uiOffset:         uiOffset,
+		iterations:       iterations,
+		textureSize:      textureSize,
+		framerate:        framerate,
+		playername:       playername,
+		renderTime:       renderTime,
+		freezeAnimations: freezeAnimations,
+		output:           outputNames(outputs),
+		checkpointFile:   checkpoint.File,
+		checkpointEvery:  max(checkpoint.Every, 1),
+		cards:            cards,
+		effects:          encoderOpts.Effects,
+		workers:          renderWorkers(encoderOpts.Workers, width, height, textureSize),
+		pace:             encoderOpts.Pace,
+		stats:            stats,
+		world:            layout.world,
+	}
+	if render.pace > 0 {
+		if checkpoint.File != "" {
+			return errors.New("--checkpoint cannot be combined with --pace yet, frames are cut by time from the first record")
+		}
+		if err := render.checkPace(dest); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("Paced frames: %v of real time per frame, unchanged frames are skipped where the output allows it", render.pace))
+	}
+
+	// reverse plays back from the final canvas, undoing the records one by one
+	state := newRenderState(render)
+	state.textures = textures
+	state.keepHistory(dest)
+	if reverse {
+		if checkpoint.File != "" {
+			return errors.New("--checkpoint cannot be combined with --reverse, reversed records cannot be resumed by id")
+		}
+		dest = render.reverse(dest, state)
+		log.Info("Reverse mode: final canvas drawn, playing the records backwards")
+	}
+
+	if format, ok := animationFormats[strings.ToLower(filepath.Ext(filename))]; ok {
+		if len(outputs) > 1 || outputs[0].Width > 0 {
+			return fmt.Errorf("%s animations are rendered on their own at the canvas size (frames are dropped to meet --max-size), use --width/--height and a single --output", format)
+		}
+		if checkpoint.File != "" {
+			return fmt.Errorf("--checkpoint is not supported for %s animations, they are rendered in one go", format)
+		}
+		return encodeAnimation(dest, render, state, filename, format, quality, encoderOpts.MaxSize, debug)
+	}
+	for _, target := range outputs {
+		ext := outputFormat(target.File)
+		if format, ok := animationFormats[ext]; ok {
+			return fmt.Errorf("%s animations are rendered on their own (frames are dropped to meet --max-size), they cannot share the render with other outputs", format)
+		}
+		// Motion-JPEG AVI is written in pure Go, the fallback for machines without ffmpeg
+		if ext == ".avi" && checkpoint.File != "" {
+			return errors.New("--checkpoint is not supported for .avi output, use a video container or a frames directory")
+		}
+		if (ext == ".avi" || ext == frameDirFormat) && target.Width > 0 {
+			return fmt.Errorf("%s: an output size needs an ffmpeg video (.mp4, .mkv, .webm, .mov), .avi and frame directories are written at the canvas size", target.File)
+		}
+	}
+
+	if checkpoint.Resume {
+		state, err = loadCheckpoint(render)
+		if err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("Resuming from checkpoint %s: frame %d, record id %d", checkpoint.File, state.frame, state.lastID))
+		state.keepHistory(dest)
+		if cards.Outro > 0 {
+			log.Warn("Stats card of a resumed render only counts the records after the checkpoint")
+		}
+	}
+	// frames of the output written before this run: the title card and the timelapse up to the checkpoint
+	doneFrames := 0
+	if state.frame > 0 {
+		doneFrames = render.cardFrames(cards.Intro) + state.frame
+	}
+
+	var clicks string
+	if encoderOpts.Audio.Clicks {
+		if state.frame > 0 {
+			log.Warn("Click track of a resumed render starts at the checkpoint, earlier frames stay silent")
+		}
+		// title card and the frames before a resume stay silent, so do the hold and the stats card
+		silent := render.cardFrames(cards.Intro) + state.frame
+		tail := render.cardFrames(cards.Hold) + render.cardFrames(cards.Outro)
+		clicks, err = writeClickTrack(dest, render.frameSpans(dest), framerate, silent, tail, encoderOpts.Audio.ClickVolume)
+		if err != nil {
+			return err
+		}
+		defer func(name string) {
+			if err := os.Remove(name); err != nil {
+				log.Warn("Could not remove click track: " + err.Error())
+			}
+		}(clicks)
+	}
+	audio := newSoundtrack(encoderOpts.Audio, clicks, render.videoFrames(state.frame+len(render.frameSpans(dest))), framerate)
+
+	// one frame stream for every output, each encoded (and scaled) on its own
+	opened := make([]renderOutput, 0, len(outputs))
+	sinks := make([]frameSink, 0, len(outputs))
+	gpus := outputsGPU(outputs, encoderOpts)
+	for _, target := range outputs {
+		o, err := render.openOutput(target, state, doneFrames, encoderOpts, gpus, quality, audio, debug)
+		if err != nil {
+			closeSinks(sinks...)
+			return err
+		}
+		opened = append(opened, o)
+		sinks = append(sinks, o.sink)
+	}
+	sink := sinks[0]
+	if len(sinks) > 1 {
+		sink = newTeeSink(sinks)
+	}
+	frames, err := render.run(dest, 1, state, sink)
+	if err != nil {
+		closeSinks(sink)
+		return err
+	}
+	if err = sink.Close(); err != nil {
+		return err
+	}
+	render.removeCheckpoint()
+
+	var errs []error
+	for _, o := range opened {
+		errs = append(errs, o.finish(doneFrames+frames))
+	}
+	return errors.Join(errs...)
+}
+
+// outputNames - the files of the render, a checkpoint only resumes a render writing the same ones
+func outputNames(outputs []entities.OutputTarget) string {
+	names := make([]string, len(outputs))
+	for i, target := range outputs {
+		names[i] = target.File
+	}
+	return strings.Join(names, ",")
+}
+
+// frameRender - canvas layout and timing of the rendered frames, shared by every output format
+type frameRender struct {
+	width, height, uiOffset int
+	iterations, textureSize int
+	framerate               int
+	playername              string
+	renderTime              bool
+	freezeAnimations        bool
+
+	output          string
+	checkpointFile  string // empty - no checkpoints
+	checkpointEvery int    // frames between checkpoints
+
+	cards   entities.CardOptions
+	stats   cardStats
+	effects entities.EffectOptions
+	workers int           // goroutines blitting a batch, above 1 frames are also written on their own goroutine
+	pace    time.Duration // real time per frame, 0 - iterations records per frame
+
+	paceOrigin time.Time // start of the first paced frame, zero - the first record (compare renders share one clock)
+	minFrames  int       // paced frames drawn even past the last record, so compared streams end together
+	quiet      bool      // no progress log, the compare compositor reports for its tiles
+
+	world image.Rectangle // canvas covered by the records of an --aspect layout, the rest is letterbox. Empty - all of it
+}
+
+// frameHeight - canvas height plus the footer
+func (r frameRender) frameHeight() int {
+	return r.height + r.uiOffset
+}
+
+// checkpoint - makes the written frames durable and saves the canvas, a crash loses at most checkpointEvery frames
+func (r frameRender) checkpoint(state *renderState, sink frameSink) error {
+	rs, ok := sink.(resumableSink)
+	if !ok {
+		return nil
+	}
+	parts, err := rs.Flush()
+	if err != nil {
+		return err
+	}
+	state.parts = parts
+	if err = saveCheckpoint(r, state); err != nil {
+		return err
+	}
+	log.Debugf("Checkpoint saved at frame %d (record id %d)", state.frame, state.lastID)
+	return nil
+}
+
+// removeCheckpoint - finished render does not need its checkpoint anymore
+func (r frameRender) removeCheckpoint() {
+	if r.checkpointFile == "" {
+		return
+	}
+	if err := os.Remove(r.checkpointFile); err != nil && !os.IsNotExist(err) {
+		log.Warn("Could not remove checkpoint: " + err.Error())
+	}
+}
+
+// run - title card, the timelapse itself and the outro (hold and stats card). A resumed render continues the timelapse,
+// its title card is already written. With several workers frames reach the sink through a pipelinedSink.
+// Returns the number of frames of the video, unchanged frames the sink skipped included
+func (r frameRender) run(dest []entities.VisualData, step int, state *renderState, sink frameSink) (frames int, err error) {
+	effects, err := newBlockEffects(r)
+	if err != nil {
+		return 0, err
+	}
+	out := newFrameOutput(sink, r.width, r.frameHeight(), r.pace > 0)
+	if r.workers > 1 {
+		p := newPipelinedSink(sink, r.frameHeight()*r.width*3, out.skipper)
+		defer func() {
+			if closeErr := p.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		out.sink = p
+		if out.skipper != nil {
+			out.skipper = p
+		}
+	}
+
+	if state.frame == 0 {
+		if err = r.writeIntro(out, step); err != nil {
+			return out.frames(), err
+		}
+	}
+	if err = r.drawBatches(dest, step, state, effects, out); err != nil {
+		return out.frames(), err
+	}
+	err = r.writeOutro(state, out, step)
+	out.logStats()
+	return out.frames(), err
+}
+
+// drawBatches - draws every frame span of records onto the canvas of the state and hands every step-th frame (and
+// always the last one) to the output, with the block effects drawn over it (nil - none)
+func (r frameRender) drawBatches(dest []entities.VisualData, step int, state *renderState, effects *blockEffects, out *frameOutput) error {
+	pix := state.pix
+
+	spans := r.frameSpans(dest)
+	firstFrame := state.frame
+	totalFrames := firstFrame + len(spans)
+
+	// cells holding animated textures, re-blitted when their frame changes
+	animated := state.animated
+	var paints []cellPaint
+	prevTick := 0
+	if firstFrame > 0 {
+		prevTick = videoFrameTick(firstFrame-1, r.framerate)
+	}
+	// region changed since the last written frame, dropped frames add to it
+	var dirty image.Rectangle
+	canvas := image.Rect(0, 0, r.width, r.height)
 
-	errChan := make(chan error, 1)
-	go func() {
-		var err error
-		if debug {
-			err = ffmpeg.Input("pipe:0", ffmpeg.KwArgs{
-				"f":                 "rawvideo",
-				"pix_fmt":           "rgb24",
-				"s":                 fmt.Sprintf("%dx%d", width, inputHeight),
-				"r":                 fmt.Sprintf("%d", framerate),
-				"thread_queue_size": "2", // Buffer for high-speed input
-			}).
-				Output(filename, outputArgs).
-				Silent(false).
-				WithInput(pr).
-				ErrorToStdOut().
-				OverWriteOutput().
-				Run()
-		} else {
-			err = ffmpeg.Input("pipe:0", ffmpeg.KwArgs{
-				"f":                 "rawvideo",
-				"pix_fmt":           "rgb24",
-				"s":                 fmt.Sprintf("%dx%d", width, inputHeight),
-				"r":                 fmt.Sprintf("%d", framerate),
-				"thread_queue_size": "2", // Buffer for high-speed input
-			}).
-				Output(filename, outputArgs).
-				OverWriteOutput().
-				WithInput(pr).
-				Run()
-		}
-		errChan <- err
-	}()
-
-	batchSize := iterations
-	totalFrames := (lenght + batchSize - 1) / batchSize
-
-	for i := 0; i < lenght; i += batchSize {
-		end := i + batchSize
-		if end > lenght {
-			end = lenght
-		}
-		batch := dest[i:end]
+	for i, span := range spans {
+		batch := dest[span.start:span.end]
+		frameIndex := firstFrame + i
+		tick := videoFrameTick(frameIndex, r.framerate)
 
 		renderTimer := time.Now()
+		paints = paints[:0]
 		for _, block := range batch {
-			select {
-			case err := <-errChan:
-				return fmt.Errorf("ffmpeg exited early: %w", err)
-			default:
-			}
-			tex, ok := getRawTexture(block.BlockTexture)
-			if !ok {
+			cell, tex, changed := state.place(block)
+			if !changed {
 				continue
 			}
-			// Convert RGBA -> RGB24 (255,255,255)
-			targetX := int(block.X) * textureSize
-			targetY := int(block.Y) * textureSize
-
-			texWidth := tex.Rect.Dx()
-			texHeight := tex.Rect.Dy()
-
-			for row := 0; row < texHeight; row++ {
-				canvasRowStart := (targetY+row)*stride + (targetX * 3)
-				texRowStart := row * tex.Stride
-
-				// SB check
-				if canvasRowStart >= 0 && canvasRowStart+(texWidth*3) <= len(pix) {
-					for col := 0; col < texWidth; col++ {
-						cIdx := canvasRowStart + (col * 3)
-						tIdx := texRowStart + (col * 4)
-
-						// Copy R, G, B
-						pix[cIdx] = tex.Pix[tIdx]
-						pix[cIdx+1] = tex.Pix[tIdx+1]
-						pix[cIdx+2] = tex.Pix[tIdx+2]
-					}
+			if effects != nil {
+				effects.placed(pix, cell, frameIndex)
+			}
+			paints = append(paints, cellPaint{cell, r.cellFrame(state, cell, tex, tick)})
+		}
+
+		// Step animated blocks already on canvas (new ones were drawn with the current frame above)
+		if tick != prevTick {
+			for cell, tex := range animated {
+				frame := animationFrame(tex, tick)
+				if frame != animationFrame(tex, prevTick) {
+					paints = append(paints, cellPaint{cell, frame})
 				}
 			}
 		}
-		if renderTime {
-			currentFrame := (i / batchSize) + 1
-			ts := batch[len(batch)-1].Time.Format("2006-01-02 15:04")
+		r.blitCells(pix, paints)
+		for _, p := range paints {
+			dirty = dirty.Union(cellRect(p.cell, r.textureSize).Intersect(canvas))
+		}
+		prevTick = tick
+		lastFrame := i == len(spans)-1
+
+		// dropped frames still update the canvas, only the write is skipped
+		if frameIndex%step != 0 && !lastFrame {
+			continue
+		}
 
-			drawFooter(pix, width, height, uiOffset, currentFrame, ts, playername)
+		if r.renderTime {
+			ts := span.to.Format("2006-01-02 15:04")
+
+			drawFooter(pix, r.width, r.height, r.uiOffset, frameIndex+1, ts, r.playername)
+			// frame counter changes every frame
+			dirty = dirty.Union(image.Rect(0, r.height, r.width, r.frameHeight()))
 		}
 
 		log.Debugf("Frame prepared: %v", time.Since(renderTimer))
 
 		pipeTimer := time.Now()
-		if _, err := pw.Write(pix); err != nil {
-			select {
-			case ffmpegErr := <-errChan:
-				return fmt.Errorf("ffmpeg crashed: %v", ffmpegErr)
-			default:
-				return fmt.Errorf("ffmpeg pipe broken: %w", err)
-			}
+		frame := pix
+		if effects != nil {
+			frame = effects.apply(pix, frameIndex)
+			// fading and highlighted cells change until their effect is over
+			dirty = dirty.Union(effects.region)
 		}
+		if err := out.writeDirty(frame, dirty); err != nil {
+			return err
+		}
+		dirty = image.Rectangle{}
 		log.Debugf("Pipe Write: %v", time.Since(pipeTimer))
 
-		log.CustomStreamf("info", "Progress: %d/%d frames", (i/batchSize)+1, totalFrames)
-	}
+		if r.checkpointFile != "" && (frameIndex+1)%r.checkpointEvery == 0 && !lastFrame && len(batch) > 0 {
+			state.frame = frameIndex + 1
+			state.lastID = batch[len(batch)-1].Id
+			if err := r.checkpoint(state, out.sink); err != nil {
+				return err
+			}
+		}
 
-	err := pw.Close()
-	if err != nil {
-		log.Errorf("Error while closing pipe: %v", err.Error())
-	}
-	ffmpegResult := <-errChan
-	if ffmpegResult != nil {
-		return fmt.Errorf("ffmpeg failed during finalization: %w", ffmpegResult)
+		if !r.quiet {
+			log.CustomStreamf("info", "Progress: %d/%d frames", frameIndex+1, totalFrames)
+		}
 	}
-	VerifyVideoFile(filename)
 	return nil
 }
 
@@ -220,16 +417,25 @@ func GeneratePhotoLocal(dest *[]entities.VisualData, width, height, textureSize
 	//}
 
 	start := time.Now()
+	// removals restore the block below, the photo needs the same history as the video
+	photo := &renderState{}
+	photo.keepHistory(*dest)
 	for _, block := range *dest {
-		tex, ok := getRawTexture(block.BlockTexture)
-		if !ok {
-			log.Infof("Texture %s is missing in assets folder", block.BlockTexture)
+		cell, tex, changed := photo.place(block)
+		if !changed {
+			if !block.Removed {
+				log.Infof("Texture %s is missing in assets folder", block.BlockTexture)
+			}
 			continue
 		}
 
-		posX := int(block.X) * textureSize
-		posY := int(block.Y) * textureSize
+		posX := cell.X * textureSize
+		posY := cell.Y * textureSize
 
+		if tex == nil {
+			draw.Draw(canvas, image.Rect(posX, posY, posX+textureSize, posY+textureSize), image.White, image.Point{}, draw.Src)
+			continue
+		}
 		fastBlit(canvas, tex, posX, posY)
 	}
 	log.Successf("Canvas rendered in %v", time.Since(start))
@@ -253,27 +459,107 @@ func GeneratePhotoLocal(dest *[]entities.VisualData, width, height, textureSize
 	return nil
 }
 
-func VerifyVideoFile(filename string) {
+// ErrNoFFprobe - verification skipped, ffprobe is not installed
+var ErrNoFFprobe = errors.New("ffprobe was not found on PATH")
+
+// ffprobeOutput - fields of `ffprobe -of json` used by VerifyVideoFile, numbers are reported as strings
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecName     string `json:"codec_name"`
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		PixFmt        string `json:"pix_fmt"`
+		NbFrames      string `json:"nb_frames"`
+		NbReadPackets string `json:"nb_read_packets"`
+		Duration      string `json:"duration"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		Size     string `json:"size"`
+	} `json:"format"`
+}
+
+// VerifyVideoFile - reads codec, size and frame count of the first video stream with ffprobe
+func VerifyVideoFile(filename string) (entities.VideoInfo, error) {
+	var info entities.VideoInfo
+	if !toolFound("ffprobe") {
+		return info, ErrNoFFprobe
+	}
 	log.Notice(fmt.Sprintf("Running ffprobe verification on %s", filename))
 	args := []string{
 		"-v", "error",
 		"-select_streams", "v:0",
-		"-show_entries", "stream=width,height,nb_frames,codec_name",
-		"-of", "default=noprint_wrappers=1",
+		"-count_packets", // nb_frames is missing in mkv/webm, packets are counted without decoding
+		"-show_entries", "stream=codec_name,width,height,pix_fmt,nb_frames,nb_read_packets,duration:format=duration,size",
+		"-of", "json",
 		filename,
 	}
 
 	cmd := exec.Command("ffprobe", args...)
-	output, err := cmd.CombinedOutput()
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return info, fmt.Errorf("ffprobe could not read %s: %s", filename, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return info, fmt.Errorf("ffprobe failed: %w", err)
+	}
 
+	var probe ffprobeOutput
+	if err = json.Unmarshal(output, &probe); err != nil {
+		return info, fmt.Errorf("could not parse ffprobe output: %w", err)
+	}
+	if len(probe.Streams) == 0 {
+		return info, fmt.Errorf("%s has no video stream", filename)
+	}
+
+	stream := probe.Streams[0]
+	info.Codec = stream.CodecName
+	info.Width = stream.Width
+	info.Height = stream.Height
+	info.PixFmt = stream.PixFmt
+	info.Frames, _ = strconv.Atoi(stream.NbFrames)
+	if info.Frames == 0 {
+		info.Frames, _ = strconv.Atoi(stream.NbReadPackets)
+	}
+	info.Duration, _ = strconv.ParseFloat(stream.Duration, 64)
+	if info.Duration == 0 {
+		info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	}
+	info.Size, _ = strconv.ParseInt(probe.Format.Size, 10, 64)
+	return info, nil
+}
+
+// checkVideo - compares what ffprobe found with what was written, any difference means a broken or truncated file
+func checkVideo(filename string, expected entities.VideoInfo) error {
+	info, err := VerifyVideoFile(filename)
+	if errors.Is(err, ErrNoFFprobe) {
+		log.Warn(fmt.Sprintf("%v, skipping verification of %s", err, filename))
+		return nil
+	}
 	if err != nil {
-		log.Errorf("Verification Failed! ffprobe reported an error: %v", err)
-		log.Errorf("ffprobe output: %s", string(output))
-		return
+		return fmt.Errorf("verification failed: %w", err)
 	}
 
-	stats := strings.ReplaceAll(string(output), "\n", " | ")
-	log.Successf("Video Verified: %s", stats)
+	var problems []string
+	if expected.Codec != "" && info.Codec != expected.Codec {
+		problems = append(problems, fmt.Sprintf("codec %s, expected %s", info.Codec, expected.Codec))
+	}
+	if info.Width != expected.Width || info.Height != expected.Height {
+		problems = append(problems, fmt.Sprintf("resolution %dx%d, expected %dx%d", info.Width, info.Height, expected.Width, expected.Height))
+	}
+	if info.Frames != expected.Frames {
+		problems = append(problems, fmt.Sprintf("%d frames, expected %d", info.Frames, expected.Frames))
+	}
+	if info.Size == 0 {
+		problems = append(problems, "file is empty")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("verification of %s failed: %s", filename, strings.Join(problems, ", "))
+	}
+
+	log.Successf("Video Verified: %s %dx%d %s | %d frames | %.2fs | %d bytes", info.Codec, info.Width, info.Height, info.PixFmt, info.Frames, info.Duration, info.Size)
+	return nil
 }
 
 // Other func
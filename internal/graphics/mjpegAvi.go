@@ -0,0 +1,260 @@
+package graphics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+
+	"github.com/vovamod/utils/log"
+)
+
+// mjpegSink - pure Go Motion-JPEG in an AVI 1.0 container, the output that works without ffmpeg.
+//
+// Layout: RIFF AVI | LIST hdrl (avih, LIST strl (strh, strf)) | LIST movi (00dc jpeg chunks) | idx1.
+// Frame counts and sizes are unknown up front, their header fields are patched on Close
+type mjpegSink struct {
+	f       *os.File
+	w       *bufio.Writer
+	img     *image.RGBA
+	width   int // of the piped frames, img is upscale times larger
+	upscale int
+	quality int
+	buf     bytes.Buffer
+
+	offset   int64 // bytes written so far
+	moviPos  int64 // position of the "movi" fourcc, idx1 offsets are relative to it
+	patches  aviPatches
+	index    []byte
+	frames   int
+	maxChunk int
+}
+
+// aviPatches - header positions rewritten once the stream is finished
+type aviPatches struct {
+	riffSize, moviSize             int64
+	totalFrames, length            int64
+	avihBufferSize, strhBufferSize int64
+}
+
+const aviMaxSize = math.MaxUint32
+
+// newMJPEGSink - width x height rgb24 frames, stored upscaled by --upscale (nearest neighbour, like the ffmpeg outputs)
+func newMJPEGSink(filename string, width, height, framerate int, quality qualitySettings) (*mjpegSink, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not create file: %w", err)
+	}
+	upscale := max(quality.Upscale, 1)
+	s := &mjpegSink{
+		f:       f,
+		w:       bufio.NewWriter(f),
+		img:     image.NewRGBA(image.Rect(0, 0, width*upscale, height*upscale)),
+		width:   width,
+		upscale: upscale,
+		quality: jpegQuality(quality.CRF),
+	}
+	width, height = width*upscale, height*upscale
+	for i := 3; i < len(s.img.Pix); i += 4 {
+		s.img.Pix[i] = 255
+	}
+
+	var h bytes.Buffer
+	u32 := func(v uint32) { h.Write(binary.LittleEndian.AppendUint32(nil, v)) }
+	u16 := func(v uint16) { h.Write(binary.LittleEndian.AppendUint16(nil, v)) }
+	mark := func() int64 { return int64(h.Len()) }
+
+	h.WriteString("RIFF")
+	s.patches.riffSize = mark()
+	u32(0)
+	h.WriteString("AVI ")
+
+	h.WriteString("LIST")
+	u32(4 + 8 + 56 + 12 + 8 + 56 + 8 + 40) // hdrl: avih, LIST strl (strh, strf)
+	h.WriteString("hdrl")
+	h.WriteString("avih")
+	u32(56)
+	u32(uint32(1000000 / framerate)) // microseconds per frame
+	u32(0)                           // max bytes per second
+	u32(0)                           // padding granularity
+	u32(0x10)                        // AVIF_HASINDEX
+	s.patches.totalFrames = mark()
+	u32(0)
+	u32(0) // initial frames
+	u32(1) // streams
+	s.patches.avihBufferSize = mark()
+	u32(0)
+	u32(uint32(width))
+	u32(uint32(height))
+	h.Write(make([]byte, 16)) // reserved
+
+	h.WriteString("LIST")
+	u32(4 + 8 + 56 + 8 + 40)
+	h.WriteString("strl")
+	h.WriteString("strh")
+	u32(56)
+	h.WriteString("vids")
+	h.WriteString("MJPG")
+	u32(0) // flags
+	u16(0) // priority
+	u16(0) // language
+	u32(0) // initial frames
+	u32(1) // scale
+	u32(uint32(framerate))
+	u32(0) // start
+	s.patches.length = mark()
+	u32(0)
+	s.patches.strhBufferSize = mark()
+	u32(0)
+	u32(math.MaxUint32) // default quality
+	u32(0)              // sample size, 0 - variable
+	u16(0)
+	u16(0)
+	u16(uint16(width))
+	u16(uint16(height))
+
+	h.WriteString("strf") // BITMAPINFOHEADER
+	u32(40)
+	u32(40)
+	u32(uint32(width))
+	u32(uint32(height))
+	u16(1)  // planes
+	u16(24) // bits per pixel
+	h.WriteString("MJPG")
+	u32(uint32(width * height * 3))
+	h.Write(make([]byte, 16)) // pixels per meter, colours used / important
+
+	h.WriteString("LIST")
+	s.patches.moviSize = mark()
+	u32(0)
+	s.moviPos = mark()
+	h.WriteString("movi")
+
+	if _, err = s.w.Write(h.Bytes()); err != nil {
+		return nil, fmt.Errorf("could not write avi header: %w", err)
+	}
+	s.offset = int64(h.Len())
+	return s, nil
+}
+
+// jpegQuality - x264 crf moved to the jpeg 1-100 scale: standard (23) is 85, archive (16) 90
+func jpegQuality(crf int) int {
+	return min(max(100-crf*2/3, 1), 100)
+}
+
+func (s *mjpegSink) WriteFrame(pix []uint8) error {
+	if s.upscale == 1 {
+		dst := s.img.Pix
+		for i, j := 0, 0; i+2 < len(pix); i, j = i+3, j+4 {
+			dst[j], dst[j+1], dst[j+2] = pix[i], pix[i+1], pix[i+2]
+		}
+	} else {
+		s.upscaleFrame(pix)
+	}
+
+	s.buf.Reset()
+	if err := jpeg.Encode(&s.buf, s.img, &jpeg.Options{Quality: s.quality}); err != nil {
+		return fmt.Errorf("jpeg encoding failed: %w", err)
+	}
+	size := s.buf.Len()
+	chunk := 8 + size + size%2 // chunks are padded to an even size
+	if s.offset+int64(chunk)+int64(len(s.index))+16*(int64(s.frames)+1)+8 > aviMaxSize {
+		return errors.New("avi file reached its 4GB limit, lower --quality or the resolution, or use ffmpeg outputs")
+	}
+
+	// idx1 entry: chunk id, AVIIF_KEYFRAME, offset from the movi fourcc, size
+	s.index = append(s.index, "00dc"...)
+	s.index = binary.LittleEndian.AppendUint32(s.index, 0x10)
+	s.index = binary.LittleEndian.AppendUint32(s.index, uint32(s.offset-s.moviPos))
+	s.index = binary.LittleEndian.AppendUint32(s.index, uint32(size))
+
+	// bufio keeps the first write error, it is returned by Flush on Close
+	s.w.WriteString("00dc")
+	s.w.Write(binary.LittleEndian.AppendUint32(nil, uint32(size)))
+	s.w.Write(s.buf.Bytes())
+	if size%2 == 1 {
+		s.w.WriteByte(0)
+	}
+	s.offset += int64(chunk)
+	s.frames++
+	s.maxChunk = max(s.maxChunk, size)
+	return nil
+}
+
+// upscaleFrame - every frame pixel becomes an upscale x upscale square of img
+func (s *mjpegSink) upscaleFrame(pix []uint8) {
+	stride := s.img.Stride
+	for y := 0; y < len(pix)/(s.width*3); y++ {
+		src := pix[y*s.width*3 : (y+1)*s.width*3]
+		row := s.img.Pix[y*s.upscale*stride : (y*s.upscale+1)*stride]
+		for x := 0; x < s.width; x++ {
+			for k := 0; k < s.upscale; k++ {
+				j := (x*s.upscale + k) * 4
+				row[j], row[j+1], row[j+2] = src[x*3], src[x*3+1], src[x*3+2]
+			}
+		}
+		for k := 1; k < s.upscale; k++ {
+			copy(s.img.Pix[(y*s.upscale+k)*stride:], row)
+		}
+	}
+}
+
+// SkipFrame - empty 00dc chunk, players keep showing the previous frame (the usual AVI "drop frame")
+func (s *mjpegSink) SkipFrame() error {
+	if s.offset+8+int64(len(s.index))+16*(int64(s.frames)+1)+8 > aviMaxSize {
+		return errors.New("avi file reached its 4GB limit, lower --quality or the resolution, or use ffmpeg outputs")
+	}
+	s.index = append(s.index, "00dc"...)
+	s.index = binary.LittleEndian.AppendUint32(s.index, 0)
+	s.index = binary.LittleEndian.AppendUint32(s.index, uint32(s.offset-s.moviPos))
+	s.index = binary.LittleEndian.AppendUint32(s.index, 0)
+
+	s.w.WriteString("00dc")
+	s.w.Write(binary.LittleEndian.AppendUint32(nil, 0))
+	s.offset += 8
+	s.frames++
+	return nil
+}
+
+func (s *mjpegSink) Close() error {
+	defer func(f *os.File) {
+		err := f.Close()
+		if err != nil {
+			log.Errorf("Error while closing file: %v", err)
+		}
+	}(s.f)
+	if s.frames == 0 {
+		return errors.New("no frames were rendered into the avi")
+	}
+
+	moviSize := s.offset - s.moviPos
+	s.w.WriteString("idx1")
+	s.w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s.index))))
+	s.w.Write(s.index)
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("could not write avi: %w", err)
+	}
+	fileSize := s.offset + 8 + int64(len(s.index))
+
+	for _, p := range []struct {
+		at    int64
+		value int64
+	}{
+		{s.patches.riffSize, fileSize - 8},
+		{s.patches.moviSize, moviSize},
+		{s.patches.totalFrames, int64(s.frames)},
+		{s.patches.length, int64(s.frames)},
+		{s.patches.avihBufferSize, int64(s.maxChunk)},
+		{s.patches.strhBufferSize, int64(s.maxChunk)},
+	} {
+		if _, err := s.f.WriteAt(binary.LittleEndian.AppendUint32(nil, uint32(p.value)), p.at); err != nil {
+			return fmt.Errorf("could not finish avi header: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// solidTexture - 16px texture of one colour, registered under name for the test
+func solidTexture(t testing.TB, name string, r, g, b byte) {
+	t.Helper()
+	tex := &entities.Texture{Pix: make([]byte, 16*16*4), Stride: 16 * 4, Rect: image.Rect(0, 0, 16, 16)}
+	for i := 0; i < len(tex.Pix); i += 4 {
+		tex.Pix[i], tex.Pix[i+1], tex.Pix[i+2], tex.Pix[i+3] = r, g, b, 255
+	}
+	tex.RGB = rgbFromRGBA(tex)
+	textureCacheRaw[name] = tex
+	t.Cleanup(func() { delete(textureCacheRaw, name) })
+}
+
+// testRecords - n placements of name on a diagonal, one minute apart
+func testRecords(n int, name string) []entities.VisualData {
+	start := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	dest := make([]entities.VisualData, n)
+	for i := range dest {
+		dest[i] = entities.VisualData{Id: int64(i + 1), Time: start.Add(time.Duration(i) * time.Minute), X: int64(i % 4), Y: int64(i % 4), BlockTexture: name, Owner: "tester"}
+	}
+	return dest
+}
+
+// aviIndexEntry - one idx1 record
+type aviIndexEntry struct {
+	id     string
+	flags  uint32
+	offset uint32
+	size   uint32
+}
+
+// readAVI - checks the RIFF structure of a Motion-JPEG avi and returns avih total frames, frame size and the idx1 entries
+func readAVI(t *testing.T, raw []byte) (int, image.Point, []aviIndexEntry) {
+	t.Helper()
+	u32 := func(at int) uint32 { return binary.LittleEndian.Uint32(raw[at:]) }
+
+	if string(raw[:4]) != "RIFF" || string(raw[8:12]) != "AVI " {
+		t.Fatalf("not a RIFF AVI file: %q", raw[:12])
+	}
+	if size := int(u32(4)); size != len(raw)-8 {
+		t.Fatalf("RIFF size %d, file holds %d bytes after it", size, len(raw)-8)
+	}
+	if string(raw[24:28]) != "avih" {
+		t.Fatalf("avih expected at 24, got %q", raw[24:28])
+	}
+	totalFrames := int(u32(32 + 16))
+	size := image.Pt(int(u32(32+32)), int(u32(32+36)))
+
+	movi := bytes.Index(raw, []byte("movi"))
+	if movi < 0 || string(raw[movi-8:movi-4]) != "LIST" {
+		t.Fatal("LIST movi not found")
+	}
+	idx1 := movi + int(u32(movi-4))
+	if string(raw[idx1:idx1+4]) != "idx1" {
+		t.Fatalf("idx1 expected right after movi at %d, got %q", idx1, raw[idx1:idx1+4])
+	}
+	indexSize := int(u32(idx1 + 4))
+	if indexSize%16 != 0 || idx1+8+indexSize != len(raw) {
+		t.Fatalf("idx1 of %d bytes does not end the file", indexSize)
+	}
+
+	var entries []aviIndexEntry
+	for at := idx1 + 8; at < len(raw); at += 16 {
+		e := aviIndexEntry{id: string(raw[at : at+4]), flags: u32(at + 4), offset: u32(at + 8), size: u32(at + 12)}
+		chunk := movi + int(e.offset)
+		if string(raw[chunk:chunk+4]) != e.id || u32(chunk+4) != e.size {
+			t.Fatalf("idx1 entry %+v does not point at its chunk", e)
+		}
+		entries = append(entries, e)
+	}
+	return totalFrames, size, entries
+}
+
+func TestMJPEGSinkRendersRecords(t *testing.T) {
+	solidTexture(t, "red.png", 255, 0, 0)
+	filename := filepath.Join(t.TempDir(), "out.avi")
+
+	// 10 records, 4 per frame - 3 frames
+	err := EncodeGPU(testRecords(10, "red.png"), 64, 48, 4, 16, 24, []entities.OutputTarget{{File: filename}}, "", false, false, false, false,
+		entities.EncoderOptions{Workers: 1}, entities.CheckpointOptions{}, entities.CardOptions{}, entities.FramingOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totalFrames, size, entries := readAVI(t, raw)
+	if totalFrames != 3 || len(entries) != 3 {
+		t.Fatalf("avih says %d frames, idx1 has %d entries, want 3", totalFrames, len(entries))
+	}
+	if size != image.Pt(64, 48) {
+		t.Errorf("frame size %v, want 64x48", size)
+	}
+	movi := bytes.Index(raw, []byte("movi"))
+	for i, e := range entries {
+		if e.id != "00dc" || e.flags != 0x10 || e.size == 0 {
+			t.Fatalf("frame %d: %+v, want a keyframe 00dc chunk", i, e)
+		}
+		data := raw[movi+int(e.offset)+8 : movi+int(e.offset)+8+int(e.size)]
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("frame %d is not a jpeg: %v", i, err)
+		}
+		// the first block is at 0,0 from the first frame on
+		if r, g, b, _ := img.At(8, 8).RGBA(); r>>8 < 200 || g>>8 > 60 || b>>8 > 60 {
+			t.Errorf("frame %d: block pixel is %d,%d,%d, want red", i, r>>8, g>>8, b>>8)
+		}
+	}
+}
+
+func TestMJPEGSinkUpscale(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "up.avi")
+	sink, err := newMJPEGSink(filename, 8, 6, 10, qualitySettings{CRF: 23, Upscale: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]uint8, 8*6*3)
+	frame[(1*8+2)*3] = 255 // one red pixel at 2,1
+	for i := 0; i < 2; i++ {
+		if err = sink.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalFrames, size, entries := readAVI(t, raw)
+	if totalFrames != 2 || len(entries) != 2 {
+		t.Fatalf("avih says %d frames, idx1 has %d entries, want 2", totalFrames, len(entries))
+	}
+	if size != image.Pt(24, 18) {
+		t.Errorf("frame size %v, want 24x18", size)
+	}
+	// the red pixel became the 3x3 square 6..8, 3..5
+	for _, p := range []image.Point{{6, 3}, {8, 5}} {
+		if c := sink.img.RGBAAt(p.X, p.Y); c.R != 255 {
+			t.Errorf("upscaled pixel %v = %v, want red", p, c)
+		}
+	}
+	if c := sink.img.RGBAAt(9, 3); c.R != 0 {
+		t.Errorf("pixel 9,3 = %v, want black", c)
+	}
+}
@@ -0,0 +1,193 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vovamod/utils/log"
+)
+
+// ParseOutput - "file" or "file:WIDTHxHEIGHT". Only a size suffix is split off, colons of the path (windows drives)
+// stay in the file name
+func ParseOutput(spec string) (entities.OutputTarget, error) {
+	target := entities.OutputTarget{File: spec}
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return target, nil
+	}
+	w, h, ok := strings.Cut(spec[i+1:], "x")
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if !ok || errW != nil || errH != nil {
+		return target, nil
+	}
+	if width < 2 || height < 2 {
+		return target, fmt.Errorf("%s: output size %dx%d is too small", spec, width, height)
+	}
+	if width%2 != 0 || height%2 != 0 {
+		return target, fmt.Errorf("%s: output size %dx%d has to be even, yuv420 video is stored in 2x2 blocks", spec, width, height)
+	}
+	return entities.OutputTarget{File: spec[:i], Width: width, Height: height}, nil
+}
+
+// renderOutput - sink of one output file and what the finished file is verified against
+type renderOutput struct {
+	target entities.OutputTarget
+	sink   frameSink
+	info   entities.VideoInfo
+}
+
+// openOutput - sink for the output picked by its extension: Motion-JPEG .avi, png frames (path ending with /) or an ffmpeg
+// video encoded at the output size. Frames of the render before a resume (doneFrames) are already written
+func (r frameRender) openOutput(target entities.OutputTarget, state *renderState, doneFrames int, encoderOpts entities.EncoderOptions, gpus gpuSelection, quality qualitySettings, audio *soundtrack, debug bool) (renderOutput, error) {
+	o := renderOutput{target: target}
+	height := r.frameHeight()
+	switch outputFormat(target.File) {
+	case ".avi":
+		sink, err := newMJPEGSink(target.File, r.width, height, r.framerate, quality)
+		if err != nil {
+			return o, err
+		}
+		o.sink = sink
+		o.info = entities.VideoInfo{Codec: "mjpeg", Width: sink.img.Rect.Dx(), Height: sink.img.Rect.Dy()}
+		return o, nil
+	case frameDirFormat:
+		sink, err := newPNGSequenceSink(target.File, r.width, height, doneFrames)
+		if err != nil {
+			return o, err
+		}
+		o.sink = sink
+		return o, nil
+	}
+
+	encoderOpts.Codec = ContainerCodec(target.File, encoderOpts.Codec)
+	quality.Width, quality.Height = target.Width, target.Height
+	video := newVideoOutput(target.File, r.width, height, encoderOpts, gpus, quality)
+	o.info = entities.VideoInfo{Codec: video.encoder.Format, Width: video.width, Height: video.height}
+
+	// with checkpoints the video is written in parts, a crash only loses the part in progress
+	switch {
+	case r.checkpointFile != "":
+		o.sink = newSegmentSink(target.File, state.parts, r.width, height, r.framerate, video.args, audio, debug)
+	case r.pace > 0:
+		// timestamped input, unchanged frames are not piped at all
+		o.sink = newTimedSink(target.File, r.width, height, r.framerate, video.args, audio, debug)
+	default:
+		o.sink = newFFmpegSink(target.File, r.width, height, r.framerate, 1, video.args, audio, debug)
+	}
+	return o, nil
+}
+
+// finish - logs the written file and checks it with ffprobe, frame directories are not verified
+func (o renderOutput) finish(frames int) error {
+	switch outputFormat(o.target.File) {
+	case frameDirFormat:
+		log.Successf("%d frames saved to: %s", frames, o.target.File)
+		return nil
+	case ".avi":
+		log.Successf("Motion-JPEG video with %d frames saved to: %s", frames, o.target.File)
+	}
+	info := o.info
+	info.Frames = frames
+	return checkVideo(o.target.File, info)
+}
+
+// outputsGPU - the GPU of the ffmpeg video outputs, detected (and asked for) once for all of them. Renders without one
+// do not look for GPUs at all
+func outputsGPU(outputs []entities.OutputTarget, opts entities.EncoderOptions) gpuSelection {
+	for _, target := range outputs {
+		if _, ok := containerCodecs[strings.ToLower(filepath.Ext(target.File))]; ok {
+			return selectGPU(opts)
+		}
+	}
+	return gpuSelection{}
+}
+
+// closeSinks - outputs of a render that failed: ffmpeg gets its input closed instead of waiting on the pipe, the error
+// of the render is the one reported
+func closeSinks(sinks ...frameSink) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Debugf("Closing an output of the failed render: %v", err)
+		}
+	}
+}
+
+// teeSink - every frame goes to all outputs, each sink on its own goroutine so the encoders run in parallel
+type teeSink struct {
+	sinks []frameSink
+}
+
+// skippingTeeSink - tee of sinks that all keep frame timing, an unchanged frame is skipped in every one of them
+type skippingTeeSink struct {
+	*teeSink
+}
+
+// newTeeSink - frames are only skipped when every sink can skip them
+func newTeeSink(sinks []frameSink) frameSink {
+	t := &teeSink{sinks: sinks}
+	for _, sink := range sinks {
+		if _, ok := sink.(frameSkipper); !ok {
+			return t
+		}
+	}
+	return skippingTeeSink{t}
+}
+
+// each - calls fn for every sink in parallel, errors of all of them are returned
+func (t *teeSink) each(fn func(sink frameSink) error) error {
+	errs := make([]error, len(t.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range t.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(sink)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// WriteFrame - sinks only read the frame, they can share it
+func (t *teeSink) WriteFrame(pix []uint8) error {
+	return t.each(func(sink frameSink) error {
+		return sink.WriteFrame(pix)
+	})
+}
+
+// Flush - every resumable output is made durable, they all started together so their part counts match
+func (t *teeSink) Flush() (int, error) {
+	var mu sync.Mutex
+	parts := 0
+	err := t.each(func(sink frameSink) error {
+		rs, ok := sink.(resumableSink)
+		if !ok {
+			return nil
+		}
+		n, err := rs.Flush()
+		mu.Lock()
+		parts = max(parts, n)
+		mu.Unlock()
+		return err
+	})
+	return parts, err
+}
+
+// Close - ffmpeg finalizes every output at once
+func (t *teeSink) Close() error {
+	return t.each(func(sink frameSink) error {
+		return sink.Close()
+	})
+}
+
+func (t skippingTeeSink) SkipFrame() error {
+	return t.each(func(sink frameSink) error {
+		return sink.(frameSkipper).SkipFrame()
+	})
+}
@@ -0,0 +1,188 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/vovamod/utils/log"
+)
+
+// minParallelCells - below this many cells per batch the goroutine handoff costs more than the blits, see
+// BenchmarkBlitCells. A variable so the benchmark can force the parallel path for small batches
+var minParallelCells = 256
+
+// renderWorkers - workers a render of the canvas actually gets: one (no pipelined sink, no stripe blits) on a single
+// core or for a canvas of fewer than minParallelCells cells, where no batch could ever be split, otherwise at most one
+// per core
+func renderWorkers(requested, width, height, textureSize int) int {
+	cells := (width / max(textureSize, 1)) * (height / max(textureSize, 1))
+	workers := min(max(requested, 1), runtime.NumCPU())
+	if cells < minParallelCells {
+		workers = 1
+	}
+	if workers != max(requested, 1) {
+		log.Debugf("%d workers requested, using %d (%d cores, %d cells)", requested, workers, runtime.NumCPU(), cells)
+	}
+	return workers
+}
+
+// pipelinedSink - hands frames to the wrapped sink on its own goroutine. The frame is copied into one of two buffers,
+// so frame N+1 is drawn while frame N is encoded/piped. The wrapped sink is not closed, only drained
+type pipelinedSink struct {
+	sink    frameSink
+	skipper frameSkipper // the wrapped sink, if it can skip frames
+	free    chan []uint8
+	frames  chan []uint8
+	done    chan struct{}
+	queued  sync.WaitGroup // frames and skips not handed over yet
+
+	mu  sync.Mutex
+	err error
+}
+
+func newPipelinedSink(sink frameSink, frameSize int, skipper frameSkipper) *pipelinedSink {
+	p := &pipelinedSink{
+		sink:    sink,
+		skipper: skipper,
+		free:    make(chan []uint8, 2),
+		frames:  make(chan []uint8, 2),
+		done:    make(chan struct{}),
+	}
+	p.free <- make([]uint8, frameSize)
+	p.free <- make([]uint8, frameSize)
+
+	go func() {
+		defer close(p.done)
+		for buf := range p.frames {
+			// after a failure the remaining frames are only returned, WriteFrame reports the error
+			if p.error() == nil {
+				var err error
+				if buf == nil {
+					err = p.skipper.SkipFrame()
+				} else {
+					err = p.sink.WriteFrame(buf)
+				}
+				if err != nil {
+					p.mu.Lock()
+					p.err = err
+					p.mu.Unlock()
+				}
+			}
+			if buf != nil {
+				p.free <- buf
+			}
+			p.queued.Done()
+		}
+	}()
+	return p
+}
+
+func (p *pipelinedSink) error() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *pipelinedSink) WriteFrame(pix []uint8) error {
+	if err := p.error(); err != nil {
+		return err
+	}
+	buf := <-p.free
+	copy(buf, pix)
+	p.queued.Add(1)
+	p.frames <- buf
+	return nil
+}
+
+// SkipFrame - queued in order with the frames, only used when the wrapped sink is a frameSkipper
+func (p *pipelinedSink) SkipFrame() error {
+	if err := p.error(); err != nil {
+		return err
+	}
+	p.queued.Add(1)
+	p.frames <- nil
+	return nil
+}
+
+// drain - waits until every queued frame and skip is in the wrapped sink
+func (p *pipelinedSink) drain() error {
+	p.queued.Wait()
+	return p.error()
+}
+
+// Flush - queued frames go first, then the wrapped sink makes them durable (sinks without Flush have nothing to do)
+func (p *pipelinedSink) Flush() (int, error) {
+	if err := p.drain(); err != nil {
+		return 0, err
+	}
+	if rs, ok := p.sink.(resumableSink); ok {
+		return rs.Flush()
+	}
+	return 0, nil
+}
+
+// Close - writes the queued frames and stops the goroutine
+func (p *pipelinedSink) Close() error {
+	close(p.frames)
+	<-p.done
+	return p.error()
+}
+
+// cellPaint - frame of the texture drawn over the cell, nil - background
+type cellPaint struct {
+	cell  image.Point
+	frame *entities.Texture
+}
+
+// blitCells - draws the paints in order. With several workers the canvas is split into horizontal stripes of cell
+// rows, each stripe blitted on its own goroutine (a cell only ever touches its own stripe, order within it is kept)
+func (r frameRender) blitCells(pix []uint8, paints []cellPaint) {
+	stride := r.width * 3
+	blit := func(p cellPaint) {
+		x, y := p.cell.X*r.textureSize, p.cell.Y*r.textureSize
+		if p.frame == nil {
+			clearCell(pix, stride, r.textureSize, x, y)
+			return
+		}
+		blitRGB(pix, stride, p.frame, x, y)
+	}
+	if r.workers <= 1 || len(paints) < minParallelCells {
+		for _, p := range paints {
+			blit(p)
+		}
+		return
+	}
+
+	rows := max((r.frameHeight()+r.textureSize-1)/r.textureSize, 1)
+	stripes := make([][]cellPaint, r.workers)
+	flush := func() {
+		var wg sync.WaitGroup
+		for i, stripe := range stripes {
+			if len(stripe) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(stripe []cellPaint) {
+				defer wg.Done()
+				for _, p := range stripe {
+					blit(p)
+				}
+			}(stripe)
+			stripes[i] = stripe[:0]
+		}
+		wg.Wait()
+	}
+	for _, p := range paints {
+		// cells past the side edges wrap into the neighbouring pixel row (and maybe stripe), drawn in order on their own
+		if p.cell.X < 0 || (p.cell.X+1)*r.textureSize > r.width {
+			flush()
+			blit(p)
+			continue
+		}
+		s := min(max(p.cell.Y*r.workers/rows, 0), r.workers-1)
+		stripes[s] = append(stripes[s], p)
+	}
+	flush()
+}
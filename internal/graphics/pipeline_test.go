@@ -0,0 +1,216 @@
+package graphics
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// benchPaints - n paints of 16px textures spread over a 1080x1920 canvas
+func benchPaints(b *testing.B, n int) (frameRender, []uint8, []cellPaint) {
+	b.Helper()
+	batch := newBenchBatch(b)
+	r := frameRender{width: 1080, height: 1920, textureSize: 16}
+	paints := make([]cellPaint, n)
+	for i := range paints {
+		cell := batch.cells[i%len(batch.cells)]
+		tex, _ := getRawTexture(batch.names[i%len(batch.names)])
+		paints[i] = cellPaint{cell: cell.Div(16), frame: tex}
+	}
+	return r, batch.pix, paints
+}
+
+// BenchmarkBlitCells - one batch blitted serially and by the stripe workers. The parallel runs ignore minParallelCells,
+// the batch size where they overtake the serial one is where the threshold belongs
+func BenchmarkBlitCells(b *testing.B) {
+	workerCounts := []int{1, 2, 4, runtime.NumCPU()}
+	slices.Sort(workerCounts)
+	workerCounts = slices.Compact(workerCounts)
+	for _, cells := range []int{64, 128, 256, 1024, 4096} {
+		for _, workers := range workerCounts {
+			b.Run(fmt.Sprintf("cells=%d/workers=%d", cells, workers), func(b *testing.B) {
+				r, pix, paints := benchPaints(b, cells)
+				r.workers = workers
+				defer func(threshold int) { minParallelCells = threshold }(minParallelCells)
+				minParallelCells = 0
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					r.blitCells(pix, paints)
+				}
+			})
+		}
+	}
+}
+
+// slowSink - stands in for an encoder pipe taking delay per frame
+type slowSink struct {
+	delay time.Duration
+}
+
+func (s slowSink) WriteFrame([]uint8) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+func (s slowSink) Close() error {
+	return nil
+}
+
+// BenchmarkPipelinedSink - drawing a frame and writing it to a slow sink, one after the other and overlapped
+func BenchmarkPipelinedSink(b *testing.B) {
+	r, pix, paints := benchPaints(b, 1024)
+	sink := slowSink{delay: 500 * time.Microsecond}
+
+	b.Run("direct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.blitCells(pix, paints)
+			if err := sink.WriteFrame(pix); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("pipelined", func(b *testing.B) {
+		p := newPipelinedSink(sink, len(pix), nil)
+		for i := 0; i < b.N; i++ {
+			r.blitCells(pix, paints)
+			if err := p.WriteFrame(pix); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if err := p.Close(); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+// recordingSink - remembers the order of frames (first byte) and skips (-1), Flush reports how many arrived
+type recordingSink struct {
+	mu     sync.Mutex
+	got    []int
+	failAt int // WriteFrame fails on this entry, 0 - never
+}
+
+func (s *recordingSink) WriteFrame(pix []uint8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAt > 0 && len(s.got)+1 == s.failAt {
+		return errors.New("sink failed")
+	}
+	s.got = append(s.got, int(pix[0]))
+	return nil
+}
+
+func (s *recordingSink) SkipFrame() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, -1)
+	return nil
+}
+
+func (s *recordingSink) Flush() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.got), nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// TestPipelinedSinkOrder - frames and skips reach the wrapped sink in submission order, and Flush only returns once
+// everything queued before it has arrived. Run with -race
+func TestPipelinedSinkOrder(t *testing.T) {
+	sink := &recordingSink{}
+	p := newPipelinedSink(sink, 4, sink)
+
+	var want []int
+	frame := make([]uint8, 4)
+	for i := 0; i < 200; i++ {
+		if i%3 == 2 {
+			if err := p.SkipFrame(); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, -1)
+		} else {
+			// the buffer is reused right away, the pipeline has to copy it
+			frame[0] = uint8(i)
+			if err := p.WriteFrame(frame); err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, i%256)
+		}
+		if i%17 == 0 {
+			n, err := p.Flush()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(want) {
+				t.Fatalf("Flush after %d entries saw %d of them in the sink", len(want), n)
+			}
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.got) != len(want) {
+		t.Fatalf("sink got %d entries, want %d", len(sink.got), len(want))
+	}
+	for i := range want {
+		if sink.got[i] != want[i] {
+			t.Fatalf("entry %d is %d, want %d (frames and skips out of order)", i, sink.got[i], want[i])
+		}
+	}
+}
+
+// TestPipelinedSinkError - a failing sink stops the pipeline, the error surfaces on the next calls and on Close
+func TestPipelinedSinkError(t *testing.T) {
+	sink := &recordingSink{failAt: 3}
+	p := newPipelinedSink(sink, 4, sink)
+
+	frame := make([]uint8, 4)
+	var err error
+	for i := 0; i < 50 && err == nil; i++ {
+		if i%2 == 1 {
+			err = p.SkipFrame()
+		} else {
+			err = p.WriteFrame(frame)
+		}
+		if err == nil && i%5 == 4 {
+			_, err = p.Flush()
+		}
+	}
+	if err == nil {
+		t.Fatal("the sink error never surfaced")
+	}
+	if err = p.Close(); err == nil {
+		t.Fatal("Close did not report the sink error")
+	}
+	if len(sink.got) != 2 {
+		t.Errorf("sink got %d entries after failing on the 3rd, want 2", len(sink.got))
+	}
+}
+
+func TestRenderWorkers(t *testing.T) {
+	cores := runtime.NumCPU()
+	tests := []struct {
+		name                              string
+		requested, width, height, texture int
+		want                              int
+	}{
+		{"serial", 1, 1024, 1024, 16, 1},
+		{"zero", 0, 1024, 1024, 16, 1},
+		{"small canvas", cores, 64, 64, 16, 1},
+		{"one per core", cores, 1024, 1024, 16, cores},
+		{"more than cores", 4 * cores, 1024, 1024, 16, cores},
+	}
+	for _, tt := range tests {
+		if got := renderWorkers(tt.requested, tt.width, tt.height, tt.texture); got != tt.want {
+			t.Errorf("%s: renderWorkers = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+)
+
+// ticksPerSecond - minecraft game speed, mcmeta frametime is measured in ticks
+const ticksPerSecond = 20
+
+type mcmetaFile struct {
+	Animation *struct {
+		FrameTime   int               `json:"frametime"`
+		Interpolate bool              `json:"interpolate"` // not supported, frames are switched instantly
+		Width       int               `json:"width"`
+		Height      int               `json:"height"`
+		Frames      []json.RawMessage `json:"frames"`
+	} `json:"animation"`
+}
+
+// loadAnimation - reads <texture>.png.mcmeta next to the texture. Returns nil, nil if the texture is static
+func loadAnimation(pngPath string, img image.Image, textureSizeLimit int) (*entities.TextureAnimation, error) {
+	raw, err := os.ReadFile(pngPath + ".mcmeta")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var meta mcmetaFile
+	if err = json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid mcmeta: %w", err)
+	}
+	if meta.Animation == nil {
+		return nil, nil
+	}
+
+	bounds := img.Bounds()
+	frameW, frameH := meta.Animation.Width, meta.Animation.Height
+	// vanilla behaviour: frames are square unless width/height are given explicitly
+	if frameW <= 0 && frameH <= 0 {
+		frameW = min(bounds.Dx(), bounds.Dy())
+		frameH = frameW
+	} else if frameW <= 0 {
+		frameW = bounds.Dx()
+	} else if frameH <= 0 {
+		frameH = bounds.Dy()
+	}
+
+	cols := bounds.Dx() / frameW
+	rows := bounds.Dy() / frameH
+	if cols*rows <= 1 {
+		return nil, nil
+	}
+
+	anim := &entities.TextureAnimation{}
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			origin := bounds.Min.Add(image.Pt(c*frameW, r*frameH))
+			anim.Frames = append(anim.Frames, textureFromImage(img, origin, frameW, frameH, textureSizeLimit))
+		}
+	}
+
+	defaultTime := meta.Animation.FrameTime
+	if defaultTime <= 0 {
+		defaultTime = 1
+	}
+
+	if len(meta.Animation.Frames) == 0 {
+		for i := range anim.Frames {
+			anim.Sequence = append(anim.Sequence, entities.AnimationFrame{Index: i, Time: defaultTime})
+		}
+	}
+	for _, entry := range meta.Animation.Frames {
+		frame := entities.AnimationFrame{Time: defaultTime}
+		// frame entry is either a plain index or {"index": i, "time": t}
+		if err = json.Unmarshal(entry, &frame.Index); err != nil {
+			var obj struct {
+				Index int `json:"index"`
+				Time  int `json:"time"`
+			}
+			if err = json.Unmarshal(entry, &obj); err != nil {
+				return nil, fmt.Errorf("invalid frame entry %s", string(entry))
+			}
+			frame.Index = obj.Index
+			if obj.Time > 0 {
+				frame.Time = obj.Time
+			}
+		}
+		if frame.Index < 0 || frame.Index >= len(anim.Frames) {
+			return nil, fmt.Errorf("frame index %d out of range (%d frames)", frame.Index, len(anim.Frames))
+		}
+		anim.Sequence = append(anim.Sequence, frame)
+	}
+
+	for _, f := range anim.Sequence {
+		anim.TotalTime += f.Time
+	}
+	return anim, nil
+}
+
+// animationFrame - frame of an animated texture shown at the given game tick. Static textures are returned as is
+func animationFrame(tex *entities.Texture, tick int) *entities.Texture {
+	anim := tex.Animation
+	if anim == nil || anim.TotalTime <= 0 {
+		return tex
+	}
+	t := tick % anim.TotalTime
+	for _, f := range anim.Sequence {
+		if t < f.Time {
+			return anim.Frames[f.Index]
+		}
+		t -= f.Time
+	}
+	return tex
+}
+
+// videoFrameTick - converts a video frame number to game ticks so animations play at in-game speed
+func videoFrameTick(frame, framerate int) int {
+	if framerate <= 0 {
+		return frame
+	}
+	return frame * ticksPerSecond / framerate
+}
@@ -0,0 +1,154 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stripImage - frames of size w*h stacked vertically, frame i filled with the grey value i*10
+func stripImage(w, h, frames int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h*frames))
+	for y := 0; y < h*frames; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(y / h * 10), A: 255})
+		}
+	}
+	return img
+}
+
+func TestLoadAnimation(t *testing.T) {
+	tests := []struct {
+		name   string
+		mcmeta string // "" - no mcmeta file
+		img    image.Image
+		want   []entities.AnimationFrame
+		err    bool
+	}{
+		{name: "no mcmeta", img: stripImage(16, 16, 3)},
+		{name: "no animation section", mcmeta: `{"texture": {"blur": true}}`, img: stripImage(16, 16, 3)},
+		{name: "single frame", mcmeta: `{"animation": {}}`, img: stripImage(16, 16, 1)},
+		{
+			name: "defaults", mcmeta: `{"animation": {}}`, img: stripImage(16, 16, 3),
+			want: []entities.AnimationFrame{{Index: 0, Time: 1}, {Index: 1, Time: 1}, {Index: 2, Time: 1}},
+		},
+		{
+			// interpolation is not supported, the frames are switched at the same ticks
+			name: "frametime and interpolate", mcmeta: `{"animation": {"frametime": 4, "interpolate": true}}`, img: stripImage(16, 16, 2),
+			want: []entities.AnimationFrame{{Index: 0, Time: 4}, {Index: 1, Time: 4}},
+		},
+		{
+			name: "frame list", mcmeta: `{"animation": {"frametime": 3, "frames": [2, {"index": 0, "time": 10}, {"index": 1}]}}`, img: stripImage(16, 16, 3),
+			want: []entities.AnimationFrame{{Index: 2, Time: 3}, {Index: 0, Time: 10}, {Index: 1, Time: 3}},
+		},
+		{
+			name: "explicit frame width", mcmeta: `{"animation": {"width": 8}}`, img: stripImage(16, 16, 1),
+			want: []entities.AnimationFrame{{Index: 0, Time: 1}, {Index: 1, Time: 1}},
+		},
+		{name: "index out of range", mcmeta: `{"animation": {"frames": [3]}}`, img: stripImage(16, 16, 3), err: true},
+		{name: "bad frame entry", mcmeta: `{"animation": {"frames": ["first"]}}`, img: stripImage(16, 16, 3), err: true},
+		{name: "invalid json", mcmeta: `{"animation": `, img: stripImage(16, 16, 3), err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "fire.png")
+			if tt.mcmeta != "" {
+				if err := os.WriteFile(path+".mcmeta", []byte(tt.mcmeta), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			anim, err := loadAnimation(path, tt.img, 0)
+			if (err != nil) != tt.err {
+				t.Fatalf("loadAnimation error = %v, want error %v", err, tt.err)
+			}
+			if tt.want == nil {
+				if anim != nil {
+					t.Errorf("animation %+v for a static texture", anim.Sequence)
+				}
+				return
+			}
+			if anim == nil {
+				t.Fatal("no animation")
+			}
+			if !slices.Equal(anim.Sequence, tt.want) {
+				t.Errorf("sequence = %v, want %v", anim.Sequence, tt.want)
+			}
+			total := 0
+			for _, f := range tt.want {
+				total += f.Time
+			}
+			if anim.TotalTime != total {
+				t.Errorf("TotalTime = %d, want %d", anim.TotalTime, total)
+			}
+		})
+	}
+}
+
+func TestLoadAnimationFramePixels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fire.png")
+	if err := os.WriteFile(path+".mcmeta", []byte(`{"animation": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := loadAnimation(path, stripImage(16, 16, 3), 8)
+	if err != nil || anim == nil {
+		t.Fatalf("loadAnimation = %v, %v", anim, err)
+	}
+	for i, frame := range anim.Frames {
+		if frame.Rect.Dx() != 8 || frame.Rect.Dy() != 8 {
+			t.Errorf("frame %d is %v, want cut to the 8px limit", i, frame.Rect)
+		}
+		if frame.Pix[0] != uint8(i*10) {
+			t.Errorf("frame %d starts with %d, want the %d-th strip frame", i, frame.Pix[0], i)
+		}
+	}
+}
+
+func TestAnimationFrame(t *testing.T) {
+	frames := []*entities.Texture{{}, {}, {}}
+	tex := &entities.Texture{Animation: &entities.TextureAnimation{
+		Frames:    frames,
+		Sequence:  []entities.AnimationFrame{{Index: 2, Time: 3}, {Index: 0, Time: 1}, {Index: 1, Time: 2}},
+		TotalTime: 6,
+	}}
+	tests := []struct {
+		tick int
+		want *entities.Texture
+	}{
+		{0, frames[2]},
+		{2, frames[2]},
+		{3, frames[0]},
+		{4, frames[1]},
+		{5, frames[1]},
+		{6, frames[2]}, // loops
+		{10, frames[1]},
+	}
+	for _, tt := range tests {
+		if got := animationFrame(tex, tt.tick); got != tt.want {
+			t.Errorf("tick %d: frame %p, want %p", tt.tick, got, tt.want)
+		}
+	}
+
+	static := &entities.Texture{}
+	if got := animationFrame(static, 5); got != static {
+		t.Error("static texture was not returned as is")
+	}
+}
+
+func TestVideoFrameTick(t *testing.T) {
+	tests := []struct{ frame, framerate, want int }{
+		{0, 60, 0},
+		{3, 60, 1},
+		{60, 60, ticksPerSecond},
+		{30, 30, ticksPerSecond},
+		{7, 0, 7},
+	}
+	for _, tt := range tests {
+		if got := videoFrameTick(tt.frame, tt.framerate); got != tt.want {
+			t.Errorf("videoFrameTick(%d, %d) = %d, want %d", tt.frame, tt.framerate, got, tt.want)
+		}
+	}
+}
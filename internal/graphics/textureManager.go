@@ -2,80 +2,227 @@ package graphics
 
 import (
 	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"os"
 	"strings"
-	"sync"
 
 	"github.com/vovamod/utils/log"
 )
 
-var textureCacheRaw sync.Map
+// textureCacheRaw - filled once before rendering and only read afterwards, so a plain map is safe to share
+var textureCacheRaw = make(map[string]*entities.Texture)
 
-func LoadTextureAtlas(assetPath string, textureSizeLimit int) error {
-	files, err := os.ReadDir(assetPath)
-	if err != nil {
-		return err
-	}
+// TextureIssue - problem found in a texture pack, reported before rendering starts
+type TextureIssue struct {
+	File    string
+	Problem string
+}
 
-	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".png") {
-			continue
-		}
+// LoadTextureAtlas - decodes textures of every pack in assetPaths. Later packs override textures of the earlier ones
+func LoadTextureAtlas(assetPaths []string, textureSizeLimit int, tints map[string]color.RGBA) ([]TextureIssue, error) {
+	var issues []TextureIssue
+	loadedPacks := 0
 
-		f, err := os.Open(assetPath + "/" + file.Name())
-		if err != nil {
-			log.Errorf("Error opening texture file %s: %v", file.Name(), err)
+	for _, assetPath := range assetPaths {
+		files, err := os.ReadDir(assetPath)
+		if os.IsNotExist(err) {
+			issues = append(issues, TextureIssue{File: assetPath, Problem: "assets folder does not exist"})
 			continue
 		}
-
-		img, _, err := image.Decode(f)
 		if err != nil {
-			log.Errorf("Failed to decode %s: %v", file.Name(), err)
-			continue
-		}
-		err = f.Close()
-		if err != nil {
-			log.Errorf("Failed to close file %s: %v", file.Name(), err)
-			continue
+			return issues, err
 		}
+		loadedPacks++
+
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), ".png") {
+				continue
+			}
 
-		bounds := img.Bounds()
-		origWidth := bounds.Dx()
+			texture, problems, err := loadTextureFile(assetPath+"/"+file.Name(), textureSizeLimit)
+			for _, problem := range problems {
+				issues = append(issues, TextureIssue{File: assetPath + "/" + file.Name(), Problem: problem})
+			}
+			if err != nil {
+				issues = append(issues, TextureIssue{File: assetPath + "/" + file.Name(), Problem: err.Error()})
+				continue
+			}
 
-		finalSize := origWidth
-		if textureSizeLimit > 0 && textureSizeLimit < origWidth {
-			finalSize = textureSizeLimit
+			if tint, ok := tints[file.Name()]; ok {
+				applyTint(texture, tint)
+			}
+			texture.Avg = averageColor(texture)
+			fillRGB(texture)
+
+			textureCacheRaw[file.Name()] = texture
 		}
+	}
+
+	if loadedPacks == 0 {
+		return issues, fmt.Errorf("none of the assets folders %v exist, point --assets to your texture pack", assetPaths)
+	}
+
+	log.Successf("Texture Atlas loaded into memory from %d pack(s). (Size limit: %dpx)", loadedPacks, textureSizeLimit)
+	return issues, nil
+}
 
-		var finalImg *image.RGBA
+// loadTextureFile - decodes a single png (and its .mcmeta) and checks it against the requested texture size
+func loadTextureFile(path string, textureSizeLimit int) (*entities.Texture, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unreadable: %w", err)
+	}
+	img, _, err := image.Decode(f)
+	closeErr := f.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode: %w", err)
+	}
+	if closeErr != nil {
+		log.Errorf("Failed to close file %s: %v", path, closeErr)
+	}
 
-		if finalSize == origWidth {
-			rgba := image.NewRGBA(bounds)
-			draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
-			finalImg = rgba
-		} else {
-			finalImg = image.NewRGBA(image.Rect(0, 0, finalSize, finalSize))
-			draw.Draw(finalImg, finalImg.Bounds(), img, bounds.Min, draw.Src)
+	bounds := img.Bounds()
+	texture := textureFromImage(img, bounds.Min, bounds.Dx(), bounds.Dx(), textureSizeLimit)
+
+	var problems []string
+	// Animated strips (magma_block, sea_lantern...) keep frame 0 as the base texture
+	anim, err := loadAnimation(path, img, textureSizeLimit)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("broken animation metadata, drawn as static: %v", err))
+	}
+	if anim != nil {
+		first := anim.Frames[anim.Sequence[0].Index]
+		texture = &entities.Texture{
+			Pix:       first.Pix,
+			Stride:    first.Stride,
+			Rect:      first.Rect,
+			Animation: anim,
 		}
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	switch {
+	case anim == nil && h > w && h%w == 0:
+		problems = append(problems, fmt.Sprintf("%dx%d looks like an animation strip but has no .mcmeta, only the first frame is drawn", w, h))
+	case anim == nil && w != h:
+		problems = append(problems, fmt.Sprintf("not square (%dx%d), only the top %dx%d part is drawn", w, h, w, w))
+	case anim != nil && h%w != 0:
+		problems = append(problems, fmt.Sprintf("animation strip %dx%d is not made of whole square frames", w, h))
+	}
+
+	if textureSizeLimit > 0 && w > textureSizeLimit {
+		problems = append(problems, fmt.Sprintf("%dpx wide, larger than --texture-size %d, it will be cropped", w, textureSizeLimit))
+	} else if textureSizeLimit > 0 && w < textureSizeLimit {
+		problems = append(problems, fmt.Sprintf("%dpx wide, smaller than --texture-size %d, it leaves gaps on the canvas", w, textureSizeLimit))
+	}
+
+	return texture, problems, nil
+}
+
+// textureFromImage - copies a single w*h frame starting at origin, cut down to textureSizeLimit if set
+func textureFromImage(img image.Image, origin image.Point, w, h, textureSizeLimit int) *entities.Texture {
+	if textureSizeLimit > 0 && textureSizeLimit < w {
+		w = textureSizeLimit
+	}
+	if textureSizeLimit > 0 && textureSizeLimit < h {
+		h = textureSizeLimit
+	}
 
-		textureCacheRaw.Store(file.Name(), &entities.Texture{
-			Pix:    finalImg.Pix,
-			Stride: finalImg.Stride,
-			Rect:   finalImg.Bounds(),
-		})
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), img, origin, draw.Src)
+	return &entities.Texture{
+		Pix:    rgba.Pix,
+		Stride: rgba.Stride,
+		Rect:   rgba.Bounds(),
 	}
+}
 
-	log.Successf("Texture Atlas loaded into memory. (Size limit: %dpx)", textureSizeLimit)
-	return nil
+// scaledTextures - copies of every loaded texture (animation frames included) resampled from the from to the to pixel
+// grid, box filtered when shrinking. Made for a render whose --aspect fit draws blocks at another size, the shared
+// cache stays as loaded for anything rendered after it
+func scaledTextures(from, to int) map[string]*entities.Texture {
+	scaled := make(map[*entities.Texture]*entities.Texture)
+	textures := make(map[string]*entities.Texture, len(textureCacheRaw))
+	for name, tex := range textureCacheRaw {
+		textures[name] = scaleTexture(tex, from, to, scaled)
+	}
+	return textures
+}
+
+// scaleTexture - resampled copy with its own pixel buffers, a texture shared by several names is scaled once
+func scaleTexture(tex *entities.Texture, from, to int, scaled map[*entities.Texture]*entities.Texture) *entities.Texture {
+	if c, ok := scaled[tex]; ok {
+		return c
+	}
+	w, h := tex.Rect.Dx(), tex.Rect.Dy()
+	nw, nh := max(w*to/from, 1), max(h*to/from, 1)
+
+	pix := make([]byte, nw*nh*4)
+	for y := 0; y < nh; y++ {
+		y0 := y * h / nh
+		y1 := max((y+1)*h/nh, y0+1)
+		for x := 0; x < nw; x++ {
+			x0 := x * w / nw
+			x1 := max((x+1)*w/nw, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(tex.Pix[sy*tex.Stride+sx*4+c])
+					}
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			for c := 0; c < 4; c++ {
+				pix[(y*nw+x)*4+c] = byte(sum[c] / n)
+			}
+		}
+	}
+	c := &entities.Texture{Pix: pix, Stride: nw * 4, Rect: image.Rect(0, 0, nw, nh), Avg: tex.Avg}
+	c.RGB = rgbFromRGBA(c)
+	scaled[tex] = c
+	if tex.Animation != nil {
+		anim := *tex.Animation
+		anim.Frames = make([]*entities.Texture, len(tex.Animation.Frames))
+		for i, frame := range tex.Animation.Frames {
+			anim.Frames[i] = scaleTexture(frame, from, to, scaled)
+		}
+		c.Animation = &anim
+	}
+	return c
 }
 
 func getRawTexture(name string) (*entities.Texture, bool) {
-	if val, ok := textureCacheRaw.Load(name); ok {
-		return val.(*entities.Texture), true
+	tex, ok := textureCacheRaw[name]
+	return tex, ok
+}
+
+// fillRGB - precomputes the RGB24 variant used by the video path (textures never change after loading)
+func fillRGB(tex *entities.Texture) {
+	tex.RGB = rgbFromRGBA(tex)
+	if tex.Animation != nil {
+		for _, frame := range tex.Animation.Frames {
+			frame.RGB = rgbFromRGBA(frame)
+		}
+	}
+}
+
+func rgbFromRGBA(tex *entities.Texture) []byte {
+	w, h := tex.Rect.Dx(), tex.Rect.Dy()
+	rgb := make([]byte, w*h*3)
+	for row := 0; row < h; row++ {
+		src := tex.Pix[row*tex.Stride:]
+		dst := rgb[row*w*3:]
+		for col := 0; col < w; col++ {
+			dst[col*3] = src[col*4]
+			dst[col*3+1] = src[col*4+1]
+			dst[col*3+2] = src[col*4+2]
+		}
 	}
-	return nil, false
+	return rgb
 }
 
 func fastBlit(canvas *image.RGBA, tex *entities.Texture, x, y int) {
@@ -98,3 +245,17 @@ func fastBlit(canvas *image.RGBA, tex *entities.Texture, x, y int) {
 			tex.Pix[texOffset:texOffset+paintWidth])
 	}
 }
+
+// blitRGB - copies the RGB24 variant of the texture into a packed RGB24 frame buffer, row by row
+func blitRGB(pix []uint8, stride int, tex *entities.Texture, targetX, targetY int) {
+	rowWidth := tex.Rect.Dx() * 3
+
+	for row := 0; row < tex.Rect.Dy(); row++ {
+		canvasRowStart := (targetY+row)*stride + (targetX * 3)
+
+		// SB check
+		if canvasRowStart >= 0 && canvasRowStart+rowWidth <= len(pix) {
+			copy(pix[canvasRowStart:canvasRowStart+rowWidth], tex.RGB[row*rowWidth:(row+1)*rowWidth])
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"image"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// benchBatch - one frame worth of placements (--iterations 1024) spread over a 1080x1920 canvas of 16px cells
+type benchBatch struct {
+	names  []string
+	cells  []image.Point
+	pix    []uint8
+	stride int
+}
+
+func newBenchBatch(b *testing.B) benchBatch {
+	b.Helper()
+	const width, height, size, placements = 1080, 1920, 16, 1024
+
+	rng := rand.New(rand.NewSource(1))
+	batch := benchBatch{pix: make([]uint8, width*height*3), stride: width * 3}
+	for i := 0; i < 32; i++ {
+		name := fmt.Sprintf("block_%d.png", i)
+		tex := &entities.Texture{Pix: make([]byte, size*size*4), Stride: size * 4, Rect: image.Rect(0, 0, size, size)}
+		rng.Read(tex.Pix)
+		tex.RGB = rgbFromRGBA(tex)
+		textureCacheRaw[name] = tex
+		batch.names = append(batch.names, name)
+	}
+	b.Cleanup(func() {
+		for _, name := range batch.names {
+			delete(textureCacheRaw, name)
+		}
+	})
+	for i := 0; i < placements; i++ {
+		batch.cells = append(batch.cells, image.Pt(rng.Intn(width/size)*size, rng.Intn(height/size)*size))
+	}
+	return batch
+}
+
+// blitRGBA - the frame preparation before RGB24 textures: sync.Map lookup and a per-pixel RGBA -> RGB conversion
+func blitRGBA(pix []uint8, stride int, tex *entities.Texture, targetX, targetY int) {
+	texWidth := tex.Rect.Dx()
+	for row := 0; row < tex.Rect.Dy(); row++ {
+		canvasRowStart := (targetY+row)*stride + (targetX * 3)
+		texRowStart := row * tex.Stride
+		if canvasRowStart >= 0 && canvasRowStart+(texWidth*3) <= len(pix) {
+			for col := 0; col < texWidth; col++ {
+				cIdx := canvasRowStart + (col * 3)
+				tIdx := texRowStart + (col * 4)
+				pix[cIdx] = tex.Pix[tIdx]
+				pix[cIdx+1] = tex.Pix[tIdx+1]
+				pix[cIdx+2] = tex.Pix[tIdx+2]
+			}
+		}
+	}
+}
+
+func BenchmarkBlitRGBA(b *testing.B) {
+	batch := newBenchBatch(b)
+	var cache sync.Map
+	for _, name := range batch.names {
+		cache.Store(name, textureCacheRaw[name])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, cell := range batch.cells {
+			val, _ := cache.Load(batch.names[j%len(batch.names)])
+			blitRGBA(batch.pix, batch.stride, val.(*entities.Texture), cell.X, cell.Y)
+		}
+	}
+}
+
+func BenchmarkBlitRGB(b *testing.B) {
+	batch := newBenchBatch(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, cell := range batch.cells {
+			tex, _ := getRawTexture(batch.names[j%len(batch.names)])
+			blitRGB(batch.pix, batch.stride, tex, cell.X, cell.Y)
+		}
+	}
+}
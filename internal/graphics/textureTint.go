@@ -0,0 +1,102 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Plains biome colours, minecraft tints these grayscale textures at runtime
+var (
+	grassTint   = color.RGBA{R: 0x91, G: 0xBD, B: 0x59, A: 0xFF}
+	foliageTint = color.RGBA{R: 0x77, G: 0xAB, B: 0x2F, A: 0xFF}
+	waterTint   = color.RGBA{R: 0x3F, G: 0x76, B: 0xE4, A: 0xFF}
+)
+
+var defaultTints = map[string]color.RGBA{
+	"grass_block.png":       grassTint,
+	"grass_block_top.png":   grassTint,
+	"grass.png":             grassTint,
+	"short_grass.png":       grassTint,
+	"tall_grass_top.png":    grassTint,
+	"tall_grass_bottom.png": grassTint,
+	"fern.png":              grassTint,
+	"large_fern_top.png":    grassTint,
+	"large_fern_bottom.png": grassTint,
+	"sugar_cane.png":        grassTint,
+
+	"oak_leaves.png":      foliageTint,
+	"jungle_leaves.png":   foliageTint,
+	"acacia_leaves.png":   foliageTint,
+	"dark_oak_leaves.png": foliageTint,
+	"mangrove_leaves.png": foliageTint,
+	"vine.png":            foliageTint,
+
+	// these ignore the biome
+	"birch_leaves.png":  {R: 0x80, G: 0xA7, B: 0x55, A: 0xFF},
+	"spruce_leaves.png": {R: 0x61, G: 0x99, B: 0x61, A: 0xFF},
+	"lily_pad.png":      {R: 0x20, G: 0x80, B: 0x30, A: 0xFF},
+
+	"water_still.png": waterTint,
+	"water_flow.png":  waterTint,
+}
+
+// BuildTintTable - default tints merged with user overrides (block -> "#RRGGBB", or "none" to keep the texture as is)
+func BuildTintTable(overrides map[string]string) (map[string]color.RGBA, error) {
+	tints := make(map[string]color.RGBA, len(defaultTints)+len(overrides))
+	for name, tint := range defaultTints {
+		tints[name] = tint
+	}
+
+	for name, value := range overrides {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !strings.HasSuffix(name, ".png") {
+			name += ".png"
+		}
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "none") {
+			delete(tints, name)
+			continue
+		}
+		tint, err := parseHexColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("tint for %s: %w", name, err)
+		}
+		tints[name] = tint
+	}
+	return tints, nil
+}
+
+func parseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("expected #RRGGBB, got %q", value)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("expected #RRGGBB, got %q", value)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
+
+// applyTint - multiplies texture colours by the tint in place, same as the game does
+func applyTint(tex *entities.Texture, tint color.RGBA) {
+	if tex.Animation != nil {
+		// base texture shares Pix with one of the frames
+		for _, frame := range tex.Animation.Frames {
+			tintPix(frame.Pix, tint)
+		}
+		return
+	}
+	tintPix(tex.Pix, tint)
+}
+
+func tintPix(pix []byte, tint color.RGBA) {
+	for i := 0; i+3 < len(pix); i += 4 {
+		pix[i] = uint8(uint16(pix[i]) * uint16(tint.R) / 255)
+		pix[i+1] = uint8(uint16(pix[i+1]) * uint16(tint.G) / 255)
+		pix[i+2] = uint8(uint16(pix[i+2]) * uint16(tint.B) / 255)
+	}
+}
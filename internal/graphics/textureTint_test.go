@@ -0,0 +1,60 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBuildTintTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]string
+		check     map[string]*color.RGBA // nil - no tint for the texture
+		err       bool
+	}{
+		{name: "defaults", check: map[string]*color.RGBA{"grass_block_top.png": &grassTint, "stone.png": nil}},
+		{
+			name:      "none removes a default",
+			overrides: map[string]string{"grass_block_top": "none", "oak_leaves.png": " NONE "},
+			check:     map[string]*color.RGBA{"grass_block_top.png": nil, "oak_leaves.png": nil, "grass_block.png": &grassTint},
+		},
+		{
+			name:      "override and new block",
+			overrides: map[string]string{"Water_Still": "#102030", "stone": "a0b0c0"},
+			check:     map[string]*color.RGBA{"water_still.png": {R: 0x10, G: 0x20, B: 0x30, A: 0xFF}, "stone.png": {R: 0xA0, G: 0xB0, B: 0xC0, A: 0xFF}},
+		},
+		{name: "short hex", overrides: map[string]string{"stone": "#fff"}, err: true},
+		{name: "not hex", overrides: map[string]string{"stone": "#gg0000"}, err: true},
+		{name: "empty", overrides: map[string]string{"stone": ""}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tints, err := BuildTintTable(tt.overrides)
+			if (err != nil) != tt.err {
+				t.Fatalf("BuildTintTable error = %v, want error %v", err, tt.err)
+			}
+			for name, want := range tt.check {
+				got, ok := tints[name]
+				switch {
+				case want == nil && ok:
+					t.Errorf("%s tinted %v, want no tint", name, got)
+				case want != nil && got != *want:
+					t.Errorf("%s tinted %v, want %v", name, got, *want)
+				}
+			}
+		})
+	}
+	if _, ok := defaultTints["oak_leaves.png"]; !ok {
+		t.Error("an override changed the default table")
+	}
+}
+
+func TestApplyTint(t *testing.T) {
+	tex := &entities.Texture{Pix: []byte{255, 128, 0, 200}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)}
+	applyTint(tex, color.RGBA{R: 128, G: 255, B: 255, A: 255})
+	if want := []byte{128, 128, 0, 200}; string(tex.Pix) != string(want) {
+		t.Errorf("tinted pixel %v, want %v (alpha kept)", tex.Pix, want)
+	}
+}
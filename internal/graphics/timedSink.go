@@ -0,0 +1,182 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// timedSink - frames piped into ffmpeg as uncompressed video in a minimal Matroska stream, every frame with its own
+// timestamp. Unchanged frames are not sent at all, ffmpeg repeats the previous one to keep the output at framerate.
+//
+// Layout: EBML header | Segment (unknown size, streamed) | Info | Tracks (one V_UNCOMPRESSED rgb24 track) |
+// one Cluster per frame (Timestamp, SimpleBlock)
+type timedSink struct {
+	pipe      *ffmpegSink
+	framerate int
+	frame     int // index of the next frame
+	last      []uint8
+	skipped   bool // the stream ends on skipped frames, the last one has to be sent again to keep the length
+	buf       bytes.Buffer
+}
+
+// Matroska element ids
+const (
+	mkvEBML               = 0x1A45DFA3
+	mkvEBMLVersion        = 0x4286
+	mkvEBMLReadVersion    = 0x42F7
+	mkvEBMLMaxIDLength    = 0x42F2
+	mkvEBMLMaxSizeLength  = 0x42F3
+	mkvDocType            = 0x4282
+	mkvDocTypeVersion     = 0x4287
+	mkvDocTypeReadVersion = 0x4285
+	mkvSegment            = 0x18538067
+	mkvInfo               = 0x1549A966
+	mkvTimestampScale     = 0x2AD7B1
+	mkvMuxingApp          = 0x4D80
+	mkvWritingApp         = 0x5741
+	mkvTracks             = 0x1654AE6B
+	mkvTrackEntry         = 0xAE
+	mkvTrackNumber        = 0xD7
+	mkvTrackUID           = 0x73C5
+	mkvTrackType          = 0x83
+	mkvFlagLacing         = 0x9C
+	mkvCodecID            = 0x86
+	mkvDefaultDuration    = 0x23E383
+	mkvVideo              = 0xE0
+	mkvPixelWidth         = 0xB0
+	mkvPixelHeight        = 0xBA
+	mkvColourSpace        = 0x2EB524
+	mkvCluster            = 0x1F43B675
+	mkvTimestamp          = 0xE7
+	mkvSimpleBlock        = 0xA3
+)
+
+func newTimedSink(filename string, width, height, framerate int, outputArgs ffmpeg.KwArgs, audio *soundtrack, debug bool) *timedSink {
+	// ffmpeg fills the skipped frames back in, the output stays constant frame rate
+	outputArgs["fps_mode"] = "cfr"
+	outputArgs["r"] = strconv.Itoa(framerate)
+
+	s := &timedSink{
+		pipe:      startFFmpeg(filename, ffmpeg.KwArgs{"f": "matroska"}, outputArgs, audio, debug),
+		framerate: framerate,
+		last:      make([]uint8, width*height*3),
+	}
+	s.buf.Write(mkvHeader(width, height, framerate))
+	return s
+}
+
+// mkvHeader - EBML header, the start of the Segment, Info and Tracks: everything before the first Cluster
+func mkvHeader(width, height, framerate int) []byte {
+	header := mkvElement(mkvEBML,
+		mkvUint(mkvEBMLVersion, 1),
+		mkvUint(mkvEBMLReadVersion, 1),
+		mkvUint(mkvEBMLMaxIDLength, 4),
+		mkvUint(mkvEBMLMaxSizeLength, 8),
+		mkvElement(mkvDocType, []byte("matroska")),
+		mkvUint(mkvDocTypeVersion, 4),
+		mkvUint(mkvDocTypeReadVersion, 2),
+	)
+	// segment of unknown size, ffmpeg reads it as a live stream
+	header = append(header, mkvID(mkvSegment)...)
+	header = append(header, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	header = append(header, mkvElement(mkvInfo,
+		mkvUint(mkvTimestampScale, 1000000), // timestamps in milliseconds
+		mkvElement(mkvMuxingApp, []byte("timelapse-pixelbattle")),
+		mkvElement(mkvWritingApp, []byte("timelapse-pixelbattle")),
+	)...)
+	header = append(header, mkvElement(mkvTracks, mkvElement(mkvTrackEntry,
+		mkvUint(mkvTrackNumber, 1),
+		mkvUint(mkvTrackUID, 1),
+		mkvUint(mkvTrackType, 1), // video
+		mkvUint(mkvFlagLacing, 0),
+		mkvElement(mkvCodecID, []byte("V_UNCOMPRESSED")),
+		mkvUint(mkvDefaultDuration, uint64(1000000000/framerate)),
+		mkvElement(mkvVideo,
+			mkvUint(mkvPixelWidth, uint64(width)),
+			mkvUint(mkvPixelHeight, uint64(height)),
+			mkvElement(mkvColourSpace, []byte{'R', 'G', 'B', 24}), // rgb24 raw fourcc
+		),
+	))...)
+	return header
+}
+
+func (s *timedSink) WriteFrame(pix []uint8) error {
+	copy(s.last, pix)
+	s.skipped = false
+	return s.writeCluster(pix, s.frame)
+}
+
+func (s *timedSink) SkipFrame() error {
+	s.frame++
+	s.skipped = true
+	return nil
+}
+
+// writeCluster - the frame at its timestamp, the header goes out with the first one
+func (s *timedSink) writeCluster(pix []uint8, frame int) error {
+	timestamp := (uint64(frame)*1000 + uint64(s.framerate)/2) / uint64(s.framerate)
+	// SimpleBlock: track 1 (vint), relative timestamp int16, keyframe flag, data
+	block := mkvSizedHeader(mkvSimpleBlock, 4+len(pix))
+	block = append(block, 0x81, 0x00, 0x00, 0x80)
+	ts := mkvUint(mkvTimestamp, timestamp)
+
+	s.buf.Write(mkvSizedHeader(mkvCluster, len(ts)+len(block)+len(pix)))
+	s.buf.Write(ts)
+	s.buf.Write(block)
+	if err := s.pipe.WriteFrame(s.buf.Bytes()); err != nil {
+		return err
+	}
+	s.buf.Reset()
+	if err := s.pipe.WriteFrame(pix); err != nil {
+		return err
+	}
+	s.frame = frame + 1
+	return nil
+}
+
+func (s *timedSink) Close() error {
+	if s.skipped {
+		if err := s.writeCluster(s.last, s.frame-1); err != nil {
+			return err
+		}
+	}
+	return s.pipe.Close()
+}
+
+// mkvID - element ids keep their length marker, written as is
+func mkvID(id uint32) []byte {
+	switch {
+	case id >= 1<<24:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<16:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<8:
+		return []byte{byte(id >> 8), byte(id)}
+	}
+	return []byte{byte(id)}
+}
+
+// mkvSizedHeader - id and an 8 byte size, large enough for any frame
+func mkvSizedHeader(id uint32, size int) []byte {
+	header := mkvID(id)
+	return binary.BigEndian.AppendUint64(header, uint64(size)|1<<56)
+}
+
+func mkvElement(id uint32, children ...[]byte) []byte {
+	size := 0
+	for _, child := range children {
+		size += len(child)
+	}
+	element := mkvSizedHeader(id, size)
+	for _, child := range children {
+		element = append(element, child...)
+	}
+	return element
+}
+
+func mkvUint(id uint32, value uint64) []byte {
+	return mkvElement(id, binary.BigEndian.AppendUint64(nil, value))
+}
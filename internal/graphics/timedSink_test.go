@@ -0,0 +1,239 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"path/filepath"
+	"testing"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// mkvTestElement - one parsed Matroska element, its id as written (length marker included)
+type mkvTestElement struct {
+	id      uint32
+	unknown bool // streamed element of unknown size, data runs to the end of the parent
+	data    []byte
+}
+
+// readVint - EBML variable length integer, the length marker is kept for ids and stripped for sizes
+func readVint(t *testing.T, b []byte, keepMarker bool) (uint64, int, bool) {
+	t.Helper()
+	if len(b) == 0 || b[0] == 0 {
+		t.Fatalf("invalid vint % x", b[:min(len(b), 8)])
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if len(b) < n {
+		t.Fatalf("vint of %d bytes is cut off", n)
+	}
+	value := uint64(b[0])
+	if !keepMarker {
+		value &= 0xFF >> n
+	}
+	for _, c := range b[1:n] {
+		value = value<<8 | uint64(c)
+	}
+	return value, n, !keepMarker && value == 1<<(7*n)-1
+}
+
+// mkvElements - sibling elements of b
+func mkvElements(t *testing.T, b []byte) []mkvTestElement {
+	t.Helper()
+	var elements []mkvTestElement
+	for len(b) > 0 {
+		id, idLen, _ := readVint(t, b, true)
+		size, sizeLen, unknown := readVint(t, b[idLen:], false)
+		b = b[idLen+sizeLen:]
+		if unknown {
+			size = uint64(len(b))
+		}
+		if uint64(len(b)) < size {
+			t.Fatalf("element %x of %d bytes, only %d left", id, size, len(b))
+		}
+		elements = append(elements, mkvTestElement{id: uint32(id), unknown: unknown, data: b[:size]})
+		b = b[size:]
+	}
+	return elements
+}
+
+// mkvChild - the only child with the id
+func mkvChild(t *testing.T, parent []byte, id uint32) []byte {
+	t.Helper()
+	var found [][]byte
+	for _, e := range mkvElements(t, parent) {
+		if e.id == id {
+			found = append(found, e.data)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("%d elements %x, want 1", len(found), id)
+	}
+	return found[0]
+}
+
+func mkvTestUint(t *testing.T, parent []byte, id uint32) uint64 {
+	t.Helper()
+	data := mkvChild(t, parent, id)
+	return binary.BigEndian.Uint64(append(make([]byte, 8-len(data)), data...))
+}
+
+// captureTimedSink - timedSink writing into a buffer instead of ffmpeg, the stream is complete after Close
+func captureTimedSink(width, height, framerate int) (*timedSink, *[]byte) {
+	pr, pw := io.Pipe()
+	pipe := &ffmpegSink{pw: pw, done: make(chan struct{})}
+	raw := new([]byte)
+	go func() {
+		*raw, _ = io.ReadAll(pr)
+		close(pipe.done)
+	}()
+	s := &timedSink{pipe: pipe, framerate: framerate, last: make([]uint8, width*height*3)}
+	s.buf.Write(mkvHeader(width, height, framerate))
+	return s, raw
+}
+
+// parseTimedStream - checks the header elements of the stream, returns the clusters of the segment
+func parseTimedStream(t *testing.T, raw []byte, width, height int) []mkvTestElement {
+	t.Helper()
+	top := mkvElements(t, raw)
+	if len(top) != 2 || top[0].id != mkvEBML || top[1].id != mkvSegment {
+		t.Fatalf("top level elements: %+v", top)
+	}
+	if got := string(mkvChild(t, top[0].data, mkvDocType)); got != "matroska" {
+		t.Errorf("DocType %q", got)
+	}
+	if !top[1].unknown {
+		t.Error("segment has a fixed size, ffmpeg could not read it as a stream")
+	}
+
+	segment := mkvElements(t, top[1].data)
+	if len(segment) < 2 || segment[0].id != mkvInfo || segment[1].id != mkvTracks {
+		t.Fatalf("segment does not start with Info and Tracks: %+v", segment)
+	}
+	if got := mkvTestUint(t, segment[0].data, mkvTimestampScale); got != 1000000 {
+		t.Errorf("TimestampScale %d, want milliseconds", got)
+	}
+	track := mkvChild(t, segment[1].data, mkvTrackEntry)
+	if got := string(mkvChild(t, track, mkvCodecID)); got != "V_UNCOMPRESSED" {
+		t.Errorf("CodecID %q", got)
+	}
+	video := mkvChild(t, track, mkvVideo)
+	if w, h := mkvTestUint(t, video, mkvPixelWidth), mkvTestUint(t, video, mkvPixelHeight); w != uint64(width) || h != uint64(height) {
+		t.Errorf("track size %dx%d, want %dx%d", w, h, width, height)
+	}
+	if got := mkvChild(t, video, mkvColourSpace); !bytes.Equal(got, []byte{'R', 'G', 'B', 24}) {
+		t.Errorf("ColourSpace % x, want the rgb24 fourcc", got)
+	}
+
+	clusters := segment[2:]
+	for _, c := range clusters {
+		if c.id != mkvCluster {
+			t.Fatalf("element %x after Tracks, want only clusters", c.id)
+		}
+	}
+	return clusters
+}
+
+// checkCluster - timestamp of the cluster and a keyframe SimpleBlock of track 1 holding the frame
+func checkCluster(t *testing.T, cluster mkvTestElement, timestamp uint64, frame []byte) {
+	t.Helper()
+	if got := mkvTestUint(t, cluster.data, mkvTimestamp); got != timestamp {
+		t.Errorf("cluster timestamp %d, want %d", got, timestamp)
+	}
+	block := mkvChild(t, cluster.data, mkvSimpleBlock)
+	if !bytes.Equal(block[:4], []byte{0x81, 0x00, 0x00, 0x80}) {
+		t.Errorf("SimpleBlock header % x", block[:4])
+	}
+	if !bytes.Equal(block[4:], frame) {
+		t.Error("SimpleBlock does not hold the frame")
+	}
+}
+
+func TestTimedSinkMatroska(t *testing.T) {
+	const width, height, framerate = 4, 2, 25
+	first := bytes.Repeat([]byte{10, 20, 30}, width*height)
+	second := bytes.Repeat([]byte{40, 50, 60}, width*height)
+
+	s, raw := captureTimedSink(width, height, framerate)
+	if err := s.WriteFrame(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SkipFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteFrame(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters := parseTimedStream(t, *raw, width, height)
+	if len(clusters) != 2 {
+		t.Fatalf("%d clusters, want 2 (the skipped frame is not sent)", len(clusters))
+	}
+	checkCluster(t, clusters[0], 0, first)
+	checkCluster(t, clusters[1], 2*1000/framerate, second)
+}
+
+func TestTimedSinkEndsOnSkippedFrame(t *testing.T) {
+	const width, height, framerate = 2, 2, 30
+	frame := bytes.Repeat([]byte{1, 2, 3}, width*height)
+
+	s, raw := captureTimedSink(width, height, framerate)
+	if err := s.WriteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.SkipFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last frame is sent again at the last skipped timestamp, the video keeps its length
+	clusters := parseTimedStream(t, *raw, width, height)
+	if len(clusters) != 2 {
+		t.Fatalf("%d clusters, want 2", len(clusters))
+	}
+	checkCluster(t, clusters[0], 0, frame)
+	checkCluster(t, clusters[1], (2*1000+framerate/2)/framerate, frame)
+}
+
+// TestTimedSinkFrameCount - ffmpeg fills the skipped frames back in, the file has as many frames as were counted
+func TestTimedSinkFrameCount(t *testing.T) {
+	if !toolFound("ffmpeg") || !toolFound("ffprobe") {
+		t.Skip("ffmpeg and ffprobe are needed")
+	}
+	const width, height, framerate = 16, 16, 25
+	filename := filepath.Join(t.TempDir(), "timed.mkv")
+	sink := newTimedSink(filename, width, height, framerate, ffmpeg.KwArgs{"c:v": "ffv1"}, nil, false)
+	out := newFrameOutput(sink, width, height, true)
+
+	pix := make([]uint8, width*height*3)
+	for i, changed := range []bool{true, false, false, true, true, false, true, false, false} {
+		if changed {
+			pix[i] += 100
+		}
+		if err := out.write(pix, changed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.skipped == 0 {
+		t.Fatal("no frame was skipped")
+	}
+
+	info, err := VerifyVideoFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Frames != out.frames() {
+		t.Errorf("%d frames in the file, %d written", info.Frames, out.frames())
+	}
+}
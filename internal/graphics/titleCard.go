@@ -0,0 +1,148 @@
+package graphics
+
+import (
+	"Timelapse-PixelBattle/pkg/entities"
+	"fmt"
+	"math"
+)
+
+// cardStats - numbers shown on the title and stats cards
+type cardStats struct {
+	first, last  string // date range of the records
+	placements   int
+	participants int
+}
+
+// newCardStats - stats of one or more record streams (compare renders count every tile), each sorted by time
+func newCardStats(dests ...[]entities.VisualData) cardStats {
+	stats := cardStats{}
+	owners := make(map[string]struct{})
+	for _, dest := range dests {
+		if len(dest) == 0 {
+			continue
+		}
+		// dates format as yyyy-mm-dd, the strings compare like the dates
+		first, last := dest[0].Time.Format("2006-01-02"), dest[len(dest)-1].Time.Format("2006-01-02")
+		if stats.first == "" || first < stats.first {
+			stats.first = first
+		}
+		if last > stats.last {
+			stats.last = last
+		}
+		for _, block := range dest {
+			owners[block.Owner] = struct{}{}
+			if !block.Removed {
+				stats.placements++
+			}
+		}
+	}
+	stats.participants = len(owners)
+	return stats
+}
+
+// cardFrames - video frames shown for the given number of seconds
+func (r frameRender) cardFrames(seconds float64) int {
+	return int(math.Round(seconds * float64(r.framerate)))
+}
+
+// videoFrames - every frame of the video: intro card, timelapse, hold of the final canvas and the stats card
+func (r frameRender) videoFrames(timelapseFrames int) int {
+	return r.cardFrames(r.cards.Intro) + timelapseFrames + r.cardFrames(r.cards.Hold) + r.cardFrames(r.cards.Outro)
+}
+
+// drawCard - title and stats centered on the footer colour, drawn with the footer text renderer
+func (r frameRender) drawCard(pix []uint8) {
+	for i := 0; i < len(pix); i += 3 {
+		pix[i], pix[i+1], pix[i+2] = 35, 35, 35
+	}
+
+	title := r.cards.Title
+	if title == "" {
+		title = "PIXEL BATTLE TIMELAPSE"
+	}
+	lines := []string{fmt.Sprintf("%s - %s", r.stats.first, r.stats.last)}
+	if r.stats.first == r.stats.last {
+		lines[0] = r.stats.first
+	}
+	lines = append(lines, fmt.Sprintf("%d PLACEMENTS", r.stats.placements))
+	if r.playername != "" {
+		lines = append(lines, fmt.Sprintf("PLAYER: %s", r.playername))
+	} else {
+		lines = append(lines, fmt.Sprintf("%d PARTICIPANTS", r.stats.participants))
+	}
+
+	// title takes up to 90% of the width, stats lines half of its scale
+	height := r.frameHeight()
+	titleScale := max(1, min(height/8/13, r.width*9/10/max(getTextWidth(title, 1), 1)))
+	lineScale := max(1, titleScale/2)
+	lineHeight := 13 * lineScale * 3 / 2
+
+	y := height/2 - (13*titleScale+len(lines)*lineHeight)/2
+	r.cardText(pix, y, title, titleScale)
+	y += 13*titleScale + lineHeight/2
+	for _, line := range lines {
+		r.cardText(pix, y, line, lineScale)
+		y += lineHeight
+	}
+}
+
+// cardText - centered line with its glyph tops at y, addSimpleText positions by a scaled baseline
+func (r frameRender) cardText(pix []uint8, y int, label string, scale int) {
+	x := r.width/2 - getTextWidth(label, scale)/2
+	addSimpleText(pix, x, y+11-11*scale/8, label, r.width, r.width*3, scale)
+}
+
+// writeRepeated - count video frames of the same picture, every step-th of them is written. Only the first one is a
+// change, the rest can be skipped by sinks keeping frame timing
+func writeRepeated(out *frameOutput, pix []uint8, count, step int) error {
+	for i := 0; i < count; i += step {
+		if err := out.write(pix, i == 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIntro - title card before the first timelapse frame
+func (r frameRender) writeIntro(out *frameOutput, step int) error {
+	frames := r.cardFrames(r.cards.Intro)
+	if frames == 0 {
+		return nil
+	}
+	card := make([]uint8, r.frameHeight()*r.width*3)
+	r.drawCard(card)
+	return writeRepeated(out, card, frames, step)
+}
+
+// writeOutro - holds the final canvas, then crossfades into the stats card
+func (r frameRender) writeOutro(state *renderState, out *frameOutput, step int) error {
+	if err := writeRepeated(out, state.pix, r.cardFrames(r.cards.Hold), step); err != nil {
+		return err
+	}
+
+	frames := r.cardFrames(r.cards.Outro)
+	if frames == 0 {
+		return nil
+	}
+	card := make([]uint8, len(state.pix))
+	r.drawCard(card)
+
+	fade := min(r.cardFrames(r.cards.Crossfade), frames)
+	blend := make([]uint8, len(state.pix))
+	for i := 0; i < frames; i += step {
+		frame := card
+		if i < fade {
+			// linear blend, 256 steps are plenty for a few seconds
+			alpha := uint32((i + 1) * 256 / (fade + 1))
+			for j, from := range state.pix {
+				blend[j] = uint8((uint32(from)*(256-alpha) + uint32(card[j])*alpha) >> 8)
+			}
+			frame = blend
+		}
+		// blended frames all differ, the card itself only changes once
+		if err := out.write(frame, i <= fade); err != nil {
+			return err
+		}
+	}
+	return nil
+}
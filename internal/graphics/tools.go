@@ -0,0 +1,52 @@
+package graphics
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	toolMutex sync.Mutex
+	toolCache = make(map[string]bool)
+)
+
+// toolFound - whether the binary is on PATH, looked up once
+func toolFound(name string) bool {
+	toolMutex.Lock()
+	defer toolMutex.Unlock()
+	found, ok := toolCache[name]
+	if !ok {
+		_, err := exec.LookPath(name)
+		found = err == nil
+		toolCache[name] = found
+	}
+	return found
+}
+
+// DetectTools - looks up ffmpeg and ffprobe at startup, before any data is loaded
+func DetectTools() (hasFFmpeg, hasFFprobe bool) {
+	return toolFound("ffmpeg"), toolFound("ffprobe")
+}
+
+// NeedsFFmpeg - false for outputs written in pure Go: .gif, .avi (Motion-JPEG) and png frame directories
+func NeedsFFmpeg(filename string) bool {
+	switch outputFormat(filename) {
+	case frameDirFormat, ".gif", ".avi":
+		return false
+	}
+	return true
+}
+
+// frameDirFormat - outputFormat of a directory of png frames
+const frameDirFormat = "/"
+
+// outputFormat - lower case extension of the output, frameDirFormat for a path ending with a separator. A name without
+// extension is "", not a directory, so a forgotten extension is an error instead of a directory full of pngs
+func outputFormat(filename string) string {
+	if strings.HasSuffix(filename, "/") || strings.HasSuffix(filename, string(filepath.Separator)) {
+		return frameDirFormat
+	}
+	return strings.ToLower(filepath.Ext(filename))
+}
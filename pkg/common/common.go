@@ -2,9 +2,14 @@ package common
 
 import (
 	"Timelapse-PixelBattle/pkg/entities"
+	"bufio"
 	"encoding/json"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/vovamod/utils/log"
@@ -74,29 +79,154 @@ func getWindowsGPUs() []entities.GPU {
 }
 
 // Linux Implementation
+
+// sysfsRoot - sysfs mount point, can be pointed to a fake tree
+var sysfsRoot = "/sys"
+
+// pciIDsFiles - locations of the pci.ids database (hwdata, pciutils), the first one found names the devices
+var pciIDsFiles = []string{"/usr/share/hwdata/pci.ids", "/usr/share/misc/pci.ids", "/usr/share/pci.ids"}
+
 func getLinuxGPUs() []entities.GPU {
-	var gpus []entities.GPU
-	cmd := exec.Command("lspci", "-nnk")
-	output, _ := cmd.Output()
-	lines := strings.Split(string(output), "\n")
+	return readDRMGPUs(sysfsRoot)
+}
+
+// readDRMGPUs - enumerates DRM cards from <root>/class/drm and matches them with their render nodes through the shared
+// PCI device. No lspci needed (absent in alpine)
+func readDRMGPUs(root string) []entities.GPU {
+	drmDir := filepath.Join(root, "class", "drm")
+	entries, err := os.ReadDir(drmDir)
+	if err != nil {
+		log.Warn("Failed to read " + drmDir + ". Error: " + err.Error())
+		return []entities.GPU{}
+	}
+
+	renderNodes := make(map[string]string)
+	var cards []string
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, "renderD"):
+			device, err := filepath.EvalSymlinks(filepath.Join(drmDir, name, "device"))
+			if err == nil {
+				renderNodes[device] = "/dev/dri/" + name
+			}
+		case strings.HasPrefix(name, "card") && !strings.Contains(name, "-"): // card0-HDMI-A-1 are connectors
+			cards = append(cards, name)
+		}
+	}
 
-	for _, line := range lines {
-		if !strings.Contains(line, "VGA") && !strings.Contains(line, "3D controller") {
+	var gpus []entities.GPU
+	for _, card := range cards {
+		device, err := filepath.EvalSymlinks(filepath.Join(drmDir, card, "device"))
+		if err != nil {
 			continue
 		}
 
-		lowerLine := strings.ToLower(line)
-		vendor := identifyVendor(lowerLine)
+		vendorID := readSysfsValue(filepath.Join(device, "vendor"))
+		deviceID := readSysfsValue(filepath.Join(device, "device"))
+		driver := ""
+		if link, err := os.Readlink(filepath.Join(device, "driver")); err == nil {
+			driver = filepath.Base(link)
+		}
+		vendor := vendorFromPCIID(vendorID)
+		if vendor == "unknown" {
+			vendor = identifyVendor(driver)
+		}
 
 		gpus = append(gpus, entities.GPU{
-			Name:         line[8:],
+			Name:         gpuName(device, vendor, vendorID, deviceID, card),
 			Vendor:       vendor,
-			IsIntegrated: vendor == "intel" || (vendor == "amd" && strings.Contains(lowerLine, "integrated")),
+			IsIntegrated: isIntegratedDRM(vendor, device),
+			Driver:       driver,
+			RenderNode:   renderNodes[device],
 		})
 	}
 	return gpus
 }
 
+// gpuName - readable name to list and select the card by: the name the driver or firmware reports, the pci.ids
+// entry, and only without either the vendor with the raw ids
+func gpuName(device, vendor, vendorID, deviceID, card string) string {
+	for _, attr := range []string{"product_name", "label"} {
+		if raw, err := os.ReadFile(filepath.Join(device, attr)); err == nil && strings.TrimSpace(string(raw)) != "" {
+			return strings.TrimSpace(string(raw))
+		}
+	}
+	vendorID, deviceID = strings.TrimPrefix(vendorID, "0x"), strings.TrimPrefix(deviceID, "0x")
+	if name := pciDeviceName(vendorID, deviceID); name != "" {
+		return strings.ToUpper(vendor) + " " + name
+	}
+	return fmt.Sprintf("%s %s:%s (%s)", strings.ToUpper(vendor), vendorID, deviceID, card)
+}
+
+// pciDeviceName - device name from pci.ids, the marketing name in brackets when there is one ("AD102 [GeForce RTX
+// 4090]" - "GeForce RTX 4090")
+func pciDeviceName(vendorID, deviceID string) string {
+	for _, path := range pciIDsFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		inVendor := false
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "" || line[0] == '#' || strings.HasPrefix(line, "\t\t"): // subsystems
+			case line[0] != '\t':
+				if inVendor {
+					return ""
+				}
+				inVendor = strings.HasPrefix(strings.ToLower(line), vendorID+"  ")
+			case inVendor && strings.HasPrefix(strings.ToLower(line), "\t"+deviceID+"  "):
+				name := strings.TrimSpace(line[len(deviceID)+3:])
+				if open, end := strings.Index(name, "["), strings.LastIndex(name, "]"); open >= 0 && end > open {
+					name = name[open+1 : end]
+				}
+				return name
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func readSysfsValue(path string) string {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(string(raw)))
+}
+
+func vendorFromPCIID(id string) string {
+	switch id {
+	case "0x10de":
+		return "nvidia"
+	case "0x1002":
+		return "amd"
+	case "0x8086":
+		return "intel"
+	default:
+		return "unknown"
+	}
+}
+
+// isIntegratedDRM - intel iGPUs always sit at 00:02.0, amd APUs report a small vram carve-out
+func isIntegratedDRM(vendor, device string) bool {
+	switch vendor {
+	case "intel":
+		return strings.HasSuffix(filepath.Base(device), ":00:02.0")
+	case "amd":
+		vram, err := strconv.ParseUint(readSysfsValue(filepath.Join(device, "mem_info_vram_total")), 10, 64)
+		return err == nil && vram <= 2<<30
+	default:
+		return false
+	}
+}
+
 func identifyVendor(input string) string {
 	input = strings.ToLower(input)
 	switch {
@@ -0,0 +1,146 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePCIDevice - PCI device directory with vendor/device ids and a driver link, like /sys/devices/pci0000:00/<addr>
+func fakePCIDevice(t *testing.T, root, addr, vendor, device, driver string) string {
+	t.Helper()
+	dir := filepath.Join(root, "devices", "pci0000:00", addr)
+	driverDir := filepath.Join(root, "bus", "pci", "drivers", driver)
+	for _, d := range []string{dir, driverDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, filepath.Join(dir, "vendor"), vendor+"\n")
+	writeFile(t, filepath.Join(dir, "device"), device+"\n")
+	if err := os.Symlink(driverDir, filepath.Join(dir, "driver")); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// fakeDRMNode - class/drm/<name> with its device link
+func fakeDRMNode(t *testing.T, root, name, device string) {
+	t.Helper()
+	dir := filepath.Join(root, "class", "drm", name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(device, filepath.Join(dir, "device")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadDRMGPUs(t *testing.T) {
+	root := t.TempDir()
+
+	intel := fakePCIDevice(t, root, "0000:00:02.0", "0x8086", "0x9a49", "i915")
+	fakeDRMNode(t, root, "card0", intel)
+	fakeDRMNode(t, root, "card0-HDMI-A-1", intel)
+	fakeDRMNode(t, root, "renderD128", intel)
+
+	nvidia := fakePCIDevice(t, root, "0000:01:00.0", "0x10de", "0x2684", "nvidia")
+	fakeDRMNode(t, root, "card1", nvidia)
+	fakeDRMNode(t, root, "renderD129", nvidia)
+
+	apu := fakePCIDevice(t, root, "0000:05:00.0", "0x1002", "0x1681", "amdgpu")
+	writeFile(t, filepath.Join(apu, "mem_info_vram_total"), "536870912\n")
+	fakeDRMNode(t, root, "card2", apu)
+	fakeDRMNode(t, root, "renderD130", apu)
+
+	// unknown vendor id, no render node (display only)
+	display := fakePCIDevice(t, root, "0000:06:00.0", "0x1a03", "0x2000", "ast")
+	fakeDRMNode(t, root, "card3", display)
+
+	gpus := readDRMGPUs(root)
+	if len(gpus) != 4 {
+		t.Fatalf("got %d GPUs, want 4 (connectors are not cards): %+v", len(gpus), gpus)
+	}
+
+	want := []struct {
+		vendor, driver, renderNode string
+		integrated                 bool
+	}{
+		{"intel", "i915", "/dev/dri/renderD128", true},
+		{"nvidia", "nvidia", "/dev/dri/renderD129", false},
+		{"amd", "amdgpu", "/dev/dri/renderD130", true},
+		{"unknown", "ast", "", false},
+	}
+	for i, w := range want {
+		g := gpus[i]
+		if g.Vendor != w.vendor || g.Driver != w.driver || g.RenderNode != w.renderNode || g.IsIntegrated != w.integrated {
+			t.Errorf("GPU %d = %+v, want vendor %s driver %s render node %q integrated %v", i, g, w.vendor, w.driver, w.renderNode, w.integrated)
+		}
+	}
+}
+
+func TestReadDRMGPUsVendorFromDriver(t *testing.T) {
+	root := t.TempDir()
+	// vendor id unreadable, the driver name still tells the vendor
+	amd := fakePCIDevice(t, root, "0000:03:00.0", "", "0x744c", "amdgpu")
+	writeFile(t, filepath.Join(amd, "mem_info_vram_total"), "25753026560\n")
+	fakeDRMNode(t, root, "card0", amd)
+
+	gpus := readDRMGPUs(root)
+	if len(gpus) != 1 {
+		t.Fatalf("got %d GPUs, want 1", len(gpus))
+	}
+	if g := gpus[0]; g.Vendor != "amd" || g.IsIntegrated || g.RenderNode != "" {
+		t.Errorf("got %+v, want a discrete amd GPU without render node", g)
+	}
+}
+
+func TestReadDRMGPUsMissingTree(t *testing.T) {
+	if gpus := readDRMGPUs(t.TempDir()); len(gpus) != 0 {
+		t.Errorf("got %+v without class/drm, want none", gpus)
+	}
+}
+
+func TestReadDRMGPUsNames(t *testing.T) {
+	root := t.TempDir()
+	pciIDs := filepath.Join(root, "pci.ids")
+	writeFile(t, pciIDs, "# comment\n"+
+		"1002  Advanced Micro Devices, Inc. [AMD/ATI]\n"+
+		"\t2684  Not this one\n"+
+		"10de  NVIDIA Corporation\n"+
+		"\t1eb8  TU104GL [Tesla T4]\n"+
+		"\t\t10de 12a2  Tesla T4 subsystem\n"+
+		"\t2684  AD102 [GeForce RTX 4090]\n"+
+		"\t2704  AD103\n"+
+		"8086  Intel Corporation\n")
+	old := pciIDsFiles
+	pciIDsFiles = []string{filepath.Join(root, "missing.ids"), pciIDs}
+	t.Cleanup(func() { pciIDsFiles = old })
+
+	named := fakePCIDevice(t, root, "0000:03:00.0", "0x1002", "0x744c", "amdgpu")
+	writeFile(t, filepath.Join(named, "product_name"), "Radeon RX 7900 XTX\n")
+	fakeDRMNode(t, root, "card0", named)
+	for i, id := range []string{"0x2684", "0x2704", "0x9999"} {
+		device := fakePCIDevice(t, root, fmt.Sprintf("0000:0%d:00.0", 4+i), "0x10de", id, "nvidia")
+		fakeDRMNode(t, root, fmt.Sprintf("card%d", 1+i), device)
+	}
+
+	gpus := readDRMGPUs(root)
+	want := []string{"Radeon RX 7900 XTX", "NVIDIA GeForce RTX 4090", "NVIDIA AD103", "NVIDIA 10de:9999 (card3)"}
+	if len(gpus) != len(want) {
+		t.Fatalf("got %d GPUs, want %d", len(gpus), len(want))
+	}
+	for i, name := range want {
+		if gpus[i].Name != name {
+			t.Errorf("GPU %d named %q, want %q", i, gpus[i].Name, name)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package entities
+
+// AudioOptions - soundtrack muxed into rendered videos
+type AudioOptions struct {
+	File    string  // empty - silent video
+	Mode    string  // trim - cut at the video end, loop - repeat until the video end
+	FadeIn  float64 // seconds
+	FadeOut float64 // seconds
+
+	Clicks      bool    // generated click track following the placement rate, mixed with File if both are set
+	ClickVolume float64 // 0-1
+}
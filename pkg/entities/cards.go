@@ -0,0 +1,10 @@
+package entities
+
+// CardOptions - frames around the timelapse, lengths are in seconds, 0 - disabled
+type CardOptions struct {
+	Title     string  // empty - default title
+	Intro     float64 // title card before the first frame
+	Hold      float64 // final canvas after the last frame
+	Outro     float64 // stats card at the end
+	Crossfade float64 // blend from the final canvas into the stats card, part of Outro
+}
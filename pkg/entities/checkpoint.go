@@ -0,0 +1,8 @@
+package entities
+
+// CheckpointOptions - periodic snapshots of the render, see frameRender.checkpoint
+type CheckpointOptions struct {
+	File   string // empty - no checkpoints
+	Every  int    // frames between checkpoints
+	Resume bool   // continue from File instead of starting over
+}
@@ -1,21 +1,42 @@
 package entities
 
+import "time"
+
 type CLI struct {
 	Render struct {
-		Output string `help:"Output video file" required:""`
+		Output []string `help:"Output video file, optionally with the size to scale it to (out.mp4:1280x720). Repeat for several outputs of one render" required:"" sep:"none"`
 	} `cmd:"" help:"Render video"`
 
 	Photo struct {
 		Output string `help:"Output image file" required:""`
 	} `cmd:"" help:"Generate photo"`
 
+	Compare struct {
+		Output string   `help:"Output video file" required:""`
+		Tiles  []string `name:"tile" help:"Tile as LABEL:key=value,... (player, source, ip, user, password, tls, name, table), 2 to 4 of them" required:"" sep:"none"`
+		Sync   string   `name:"sync" enum:"frame,time" default:"frame" help:"Line the tiles up by frame index or by wall-clock time"`
+	} `cmd:"" help:"Render record streams side by side"`
+
+	Textures struct {
+		Build struct {
+			Output string `help:"Output atlas file" required:""`
+		} `cmd:"" help:"Precompile textures into a single atlas file"`
+	} `cmd:"" help:"Texture atlas tools"`
+
 	Width       int    `default:"1080"`
 	Height      int    `default:"1920"`
+	Aspect      string `name:"aspect" enum:",9:16,16:9,1:1" default:""`
+	Framing     string `name:"framing" enum:"fit,crop" default:"fit"`
 	Iterations  int    `default:"16"`
 	TextureSize int    `name:"texture-size" default:"16"`
 	Framerate   int    `default:"24"`
 	PlayerName  string `name:"playername"`
 
+	Assets         []string          `name:"assets" default:"assets"`
+	StrictTextures bool              `name:"strict-textures"`
+	Tint           map[string]string `name:"tint"`
+	Atlas          string            `name:"atlas"`
+
 	DBSource   string `name:"db-source"`
 	DBIp       string `name:"db-ip"`
 	DBUser     string `name:"db-user"`
@@ -23,8 +44,51 @@ type CLI struct {
 	DBName     string `name:"db-name"`
 	DBTable    string `name:"db-table"`
 	DBTLS      bool   `name:"db-tls"`
+	DBAction   string `name:"db-action-column"`
+
+	Codec       string `name:"codec" enum:",h264,hevc,av1,vp9,prores,ffv1" default:""`
+	Encoder     string `name:"encoder" default:"auto"`
+	GPUIndex    int    `name:"gpu-index"`
+	VAAPIDevice string `name:"vaapi-device"`
+
+	Quality string `name:"quality" enum:"draft,standard,archive" default:"standard"`
+	CRF     int    `name:"crf" default:"-1"`
+	Bitrate string `name:"bitrate"`
+	MaxRate string `name:"maxrate"`
+	Preset  string `name:"preset"`
+	Tune    string `name:"tune"`
+
+	PixelPerfect bool   `name:"pixel-perfect"`
+	Lossless     bool   `name:"lossless"`
+	Upscale      int    `name:"upscale"`
+	MaxSize      string `name:"max-size"`
+
+	Audio        string  `name:"audio"`
+	AudioMode    string  `name:"audio-mode" enum:"trim,loop" default:"trim"`
+	AudioFadeIn  float64 `name:"audio-fade-in"`
+	AudioFadeOut float64 `name:"audio-fade-out"`
+	ClickTrack   bool    `name:"click-track"`
+	ClickVolume  float64 `name:"click-volume" default:"0.5"`
+
+	Checkpoint      string `name:"checkpoint"`
+	CheckpointEvery int    `name:"checkpoint-every" default:"1000"`
+	Resume          bool   `name:"resume"`
+
+	Highlight      int    `name:"highlight"`
+	HighlightColor string `name:"highlight-color" default:"#FFD700"`
+	FadeIn         int    `name:"fade-in"`
+
+	Title     string  `name:"title"`
+	Intro     float64 `name:"intro"`
+	Hold      float64 `name:"hold"`
+	Outro     float64 `name:"outro"`
+	Crossfade float64 `name:"crossfade"`
 
-	Local    bool
-	WithInfo bool `name:"with-info"`
-	Debug    bool
+	Local            bool
+	WithInfo         bool          `name:"with-info"`
+	FreezeAnimations bool          `name:"freeze-animations"`
+	Reverse          bool          `name:"reverse"`
+	Workers          int           `name:"workers"`
+	Pace             time.Duration `name:"pace" help:"Real time per frame instead of --iterations records (e.g. 5m), at most 1000000 frames"`
+	Debug            bool
 }
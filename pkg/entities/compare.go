@@ -0,0 +1,7 @@
+package entities
+
+// CompareTile - one record stream of a compare render and the label drawn over its tile
+type CompareTile struct {
+	Label string
+	Data  []VisualData
+}
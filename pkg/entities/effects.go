@@ -0,0 +1,8 @@
+package entities
+
+// EffectOptions - effects on newly placed blocks, lengths are in frames, 0 - disabled
+type EffectOptions struct {
+	Highlight      int    // outline on cells changed in the last frames
+	HighlightColor string // #RRGGBB
+	FadeIn         int    // new block blends over the old one
+}
@@ -0,0 +1,30 @@
+package entities
+
+import "time"
+
+// EncoderOptions - how the video encoder is picked, see getGPUEncoder
+type EncoderOptions struct {
+	Codec       string // h264, hevc, av1, vp9, prores, ffv1. Empty - the default codec of the output container
+	Encoder     string // auto, cpu, nvenc, qsv, vaapi, amf or an explicit ffmpeg codec (hevc_nvenc, libx265...)
+	GPUIndex    int    // 1-based position in the detected GPU list, 0 - not set
+	VAAPIDevice string // render node used by vaapi, e.g. /dev/dri/renderD128
+
+	Quality string // draft, standard, archive
+	CRF     int    // -1 - taken from Quality
+	Bitrate string
+	MaxRate string
+	Preset  string // x264 preset names, translated for hardware encoders
+	Tune    string
+
+	PixelPerfect bool // full chroma (yuv444p / rgb) output, no colour bleeding between blocks
+	Lossless     bool // mathematically lossless encode, implies PixelPerfect
+	Upscale      int  // integer nearest neighbour upscale factor, 0 or 1 - none
+
+	MaxSize string // size limit of .gif/.apng/.webp outputs (e.g. 8M), frames are dropped to meet it
+
+	Audio   AudioOptions
+	Effects EffectOptions
+
+	Workers int           // frame preparation goroutines, 1 - draw and write on one goroutine
+	Pace    time.Duration // real time per frame, 0 - Iterations records per frame
+}
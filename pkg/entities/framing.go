@@ -0,0 +1,7 @@
+package entities
+
+// FramingOptions - how the records are placed on a frame of an aspect preset
+type FramingOptions struct {
+	Aspect string // 9:16, 16:9, 1:1. Empty - --width x --height canvas drawn from cell 0,0
+	Mode   string // fit - every record, scaled and letterboxed. crop - the most active region at --texture-size
+}
@@ -5,4 +5,5 @@ type GPU struct {
 	Vendor       string
 	IsIntegrated bool
 	Driver       string
+	RenderNode   string // /dev/dri/renderD*, linux only
 }
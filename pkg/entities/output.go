@@ -0,0 +1,7 @@
+package entities
+
+// OutputTarget - file written by a render and the size the video is scaled to fit into, 0 - the canvas size
+type OutputTarget struct {
+	File          string
+	Width, Height int
+}
@@ -1,9 +1,30 @@
 package entities
 
-import "image"
+import (
+	"image"
+	"image/color"
+)
 
 type Texture struct {
 	Pix    []byte
 	Stride int
 	Rect   image.Rectangle
+	Avg    color.RGBA // average colour of the opaque pixels
+	RGB    []byte     // Pix without alpha, packed rows of Rect.Dx()*3 bytes
+
+	// Animation is nil for static textures. Pix/Stride/Rect hold the first step of the playback, Frames[Sequence[0].Index]
+	Animation *TextureAnimation
+}
+
+// TextureAnimation - frames of a vertical strip texture described by .png.mcmeta
+type TextureAnimation struct {
+	Frames    []*Texture
+	Sequence  []AnimationFrame
+	TotalTime int // sum of Sequence times, in game ticks
+}
+
+// AnimationFrame - single step of the playback order (Index into Frames, Time in game ticks)
+type AnimationFrame struct {
+	Index int
+	Time  int
 }
@@ -0,0 +1,12 @@
+package entities
+
+// VideoInfo - first video stream of a rendered file as reported by ffprobe
+type VideoInfo struct {
+	Codec    string // ffprobe codec name: h264, hevc, av1, vp9, prores, ffv1, mjpeg
+	Width    int
+	Height   int
+	Frames   int
+	Duration float64 // seconds
+	Size     int64   // file size in bytes
+	PixFmt   string
+}
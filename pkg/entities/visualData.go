@@ -14,4 +14,6 @@ type VisualData struct {
 	Y            int64     `json:"y"`
 	BlockTexture string    `json:"c"`
 	Owner        string    `json:"owner"`
+	// Removed - the block at X, Y was broken, the cell gets back what was there before
+	Removed bool `json:"removed"`
 }